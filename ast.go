@@ -0,0 +1,480 @@
+package scss
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thijzert/go-scss/ast"
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// ParseAST parses a stylesheet into a syntax tree, for use by tools such as
+// linters and formatters. Like Parse, it recovers from syntax errors: the tree
+// contains everything that could be parsed, and all errors are returned
+// together as an ErrorList.
+func ParseAST(filename, src string) (*ast.Stylesheet, error) {
+	l := lexer.New(src, nullState)
+	l.File = filename
+	tok := NewTokenRing(l)
+	ir, err := parseIR(tok)
+
+	b := &astBuilder{file: filename, src: src, ends: make(map[ast.Statement]ast.Position)}
+	rv := &ast.Stylesheet{
+		Span: ast.Span{File: filename, Start: ast.Position{Line: 1, Column: 1}, End: b.end()},
+	}
+	rv.Statements = b.rules(ir.Rules, nil)
+	for _, c := range tok.Comments() {
+		rv.Statements = b.insertComment(rv.Statements, &ast.Comment{Span: b.span(c, c), Text: c.Value})
+	}
+	return rv, err
+}
+
+type astBuilder struct {
+	file string
+	src  string
+
+	// ends holds the position just past the ';' that ends a declaration or
+	// an @-rule. Comments before it belong to the statement.
+	ends map[ast.Statement]ast.Position
+}
+
+// span returns the span running from the start of the token a to the end of b
+func (b *astBuilder) span(a, z *lexer.Token) ast.Span {
+	rv := joinSpans(tokenSpan(a), tokenSpan(z))
+	rv.File = b.file
+	return rv
+}
+
+// end returns the position just past the end of the source
+func (b *astBuilder) end() ast.Position {
+	start := strings.LastIndex(b.src, "\n") + 1
+	return ast.Position{
+		Line:   strings.Count(b.src, "\n") + 1,
+		Column: utf8.RuneCountInString(b.src[start:]) + 1,
+		Offset: len(b.src),
+	}
+}
+
+// text returns the source text in a span
+func (b *astBuilder) text(s ast.Span) string {
+	if s.End.Offset < s.Start.Offset || s.End.Offset > len(b.src) {
+		return ""
+	}
+	return b.src[s.Start.Offset:s.End.Offset]
+}
+
+func (b *astBuilder) rules(rules []Rule, props []Property) []ast.Statement {
+	var rv []ast.Statement
+	for _, p := range props {
+		rv = append(rv, b.declaration(p))
+	}
+	for _, r := range rules {
+		if r.AtRule != nil {
+			rv = append(rv, b.atRule(r))
+		} else {
+			rv = append(rv, b.rule(r))
+		}
+	}
+
+	// Properties and nested rules are kept apart in the IR
+	sort.SliceStable(rv, func(i, j int) bool {
+		return rv[i].Location().Start.Before(rv[j].Location().Start)
+	})
+	return rv
+}
+
+func (b *astBuilder) rule(r Rule) *ast.Rule {
+	rv := &ast.Rule{}
+	for _, sel := range splitTokens(r.selector) {
+		if first, last := trimTokens(sel); first != nil {
+			span := b.span(first, last)
+			rv.Selectors = append(rv.Selectors, &ast.Selector{
+				Span: span,
+				Text: collapseSpace(b.text(span)),
+			})
+		}
+	}
+
+	rv.Block = b.block(r.Scope)
+	rv.Span = r.Span
+	if len(rv.Selectors) > 0 {
+		rv.Span = joinSpans(rv.Selectors[0].Span, rv.Block.Span)
+	}
+	return rv
+}
+
+func (b *astBuilder) block(s Scope) *ast.Block {
+	rv := &ast.Block{Statements: b.rules(s.Subrules, s.Properties)}
+	last := s.close
+	if last == nil && len(rv.Statements) > 0 {
+		// Unterminated block
+		rv.Span = joinSpans(b.span(s.open, s.open), rv.Statements[len(rv.Statements)-1].Location())
+	} else {
+		rv.Span = b.span(s.open, last)
+	}
+	return rv
+}
+
+func (b *astBuilder) declaration(p Property) *ast.Declaration {
+	rv := &ast.Declaration{
+		Span:     p.Span,
+		Property: p.Key,
+		Colon:    b.span(p.colon, p.colon).Start,
+		Value:    b.expr(p.value),
+	}
+	b.ends[rv] = b.endOf(rv, p.end)
+	return rv
+}
+
+func (b *astBuilder) atRule(r Rule) *ast.AtRule {
+	rv := &ast.AtRule{
+		Span:   r.Span,
+		Name:   r.AtRule.Name,
+		Params: b.expr(r.AtRule.params),
+	}
+	b.ends[rv] = b.endOf(rv, r.AtRule.end)
+	return rv
+}
+
+// endOf returns the position just past a statement's closing ';', or past
+// the statement itself if there is none
+func (b *astBuilder) endOf(s ast.Statement, semicolon *lexer.Token) ast.Position {
+	if semicolon != nil {
+		return tokenSpan(semicolon).End
+	}
+	return s.Location().End
+}
+
+// insertComment adds a comment to the statement or the innermost block
+// containing it
+func (b *astBuilder) insertComment(list []ast.Statement, c *ast.Comment) []ast.Statement {
+	pos := c.Span.Start
+	for _, s := range list {
+		var block *ast.Block
+		var comments *[]*ast.Comment
+		end := b.ends[s]
+		if r, ok := s.(*ast.Rule); ok {
+			block, comments, end = r.Block, &r.Comments, r.Block.Span.Start
+		} else if a, ok := s.(*ast.AtRule); ok {
+			block, comments = a.Block, &a.Comments
+			if block != nil {
+				end = block.Span.Start
+			}
+		} else if d, ok := s.(*ast.Declaration); ok {
+			comments = &d.Comments
+		}
+
+		if comments != nil && !pos.Before(s.Location().Start) && pos.Before(end) {
+			*comments = append(*comments, c)
+			return list
+		} else if block != nil && block.Span.Contains(pos) {
+			block.Statements = b.insertComment(block.Statements, c)
+			return list
+		}
+	}
+
+	i := sort.Search(len(list), func(i int) bool {
+		return c.Span.Start.Before(list[i].Location().Start)
+	})
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = c
+	return list
+}
+
+// collapseSpace replaces every run of whitespace in a selector by a single
+// space, except after a line comment, which still needs its line break.
+func collapseSpace(text string) string {
+	const space = " \t\r\n\f"
+	var rv strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' && i+1 < len(text) {
+				rv.WriteByte(c)
+				i++
+				c = text[i]
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if strings.HasPrefix(text[i:], "/*") {
+			// Block comments have their whitespace collapsed as well
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += i + 4
+			}
+			rv.WriteString(strings.Join(strings.Fields(text[i:end]), " "))
+			i = end - 1
+			continue
+		} else if strings.HasPrefix(text[i:], "//") {
+			// A line comment is copied up to the end of the line, which
+			// becomes a single line break
+			end := strings.IndexAny(text[i:], "\r\n\f")
+			if end < 0 {
+				rv.WriteString(text[i:])
+				break
+			}
+			rv.WriteString(strings.TrimRight(text[i:i+end], " \t"))
+			rv.WriteByte('\n')
+			i += end
+			for i+1 < len(text) && strings.IndexByte(space, text[i+1]) >= 0 {
+				i++
+			}
+			continue
+		} else if strings.IndexByte(space, c) >= 0 {
+			for i+1 < len(text) && strings.IndexByte(space, text[i+1]) >= 0 {
+				i++
+			}
+			c = ' '
+		}
+		rv.WriteByte(c)
+	}
+	return rv.String()
+}
+
+// splitTokens splits a list of tokens at every comma outside parentheses
+func splitTokens(toks []*lexer.Token) [][]*lexer.Token {
+	var rv [][]*lexer.Token
+	depth, start := 0, 0
+	for i, t := range toks {
+		if isOp(t, "(") || t.Type == FunctionToken {
+			depth++
+		} else if isOp(t, ")") {
+			depth--
+		} else if isOp(t, ",") && depth == 0 {
+			rv = append(rv, toks[start:i])
+			start = i + 1
+		}
+	}
+	return append(rv, toks[start:])
+}
+
+// trimTokens returns the first and last tokens that aren't whitespace
+func trimTokens(toks []*lexer.Token) (first, last *lexer.Token) {
+	for _, t := range toks {
+		if t.Type != WhitespaceToken {
+			if first == nil {
+				first = t
+			}
+			last = t
+		}
+	}
+	return
+}
+
+func isOp(t *lexer.Token, op string) bool {
+	return t != nil && t.Type == DelimToken && t.Value == op
+}
+
+// expr parses a list of tokens into an expression. It returns nil if there
+// are no tokens but whitespace.
+func (b *astBuilder) expr(toks []*lexer.Token) ast.Expr {
+	p := &exprParser{b: b, toks: toks}
+	rv := p.commaList()
+
+	// Anything left over is an unbalanced ')'
+	for p.skipSpace(); p.peek() != nil; p.skipSpace() {
+		var items []ast.Expr
+		if rv != nil {
+			items = append(items, rv)
+		}
+		t := p.next()
+		items = append(items, &ast.Literal{Span: b.span(t, t), Kind: ast.Ident, Value: t.Value})
+		if more := p.commaList(); more != nil {
+			items = append(items, more)
+		}
+		rv = &ast.List{Span: joinSpans(items[0].Location(), items[len(items)-1].Location()), Items: items}
+	}
+	return rv
+}
+
+type exprParser struct {
+	b    *astBuilder
+	toks []*lexer.Token
+	i    int
+}
+
+func (p *exprParser) peek() *lexer.Token {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return nil
+}
+
+func (p *exprParser) next() *lexer.Token {
+	rv := p.peek()
+	if rv != nil {
+		p.i++
+	}
+	return rv
+}
+
+func (p *exprParser) skipSpace() {
+	for p.i < len(p.toks) && p.toks[p.i].Type == WhitespaceToken {
+		p.i++
+	}
+}
+
+// commaList parses a comma-separated list, up to a ')' or the end
+func (p *exprParser) commaList() ast.Expr {
+	first := p.spaceList()
+	p.skipSpace()
+	if !isOp(p.peek(), ",") {
+		return first
+	}
+
+	rv := &ast.List{Comma: true}
+	if first != nil {
+		rv.Items = append(rv.Items, first)
+	}
+	for p.skipSpace(); isOp(p.peek(), ","); p.skipSpace() {
+		p.next()
+		if item := p.spaceList(); item != nil {
+			rv.Items = append(rv.Items, item)
+		}
+	}
+	if len(rv.Items) == 0 {
+		return nil
+	}
+	rv.Span = joinSpans(rv.Items[0].Location(), rv.Items[len(rv.Items)-1].Location())
+	return rv
+}
+
+// spaceList parses a space-separated list, up to a ',', ')' or the end
+func (p *exprParser) spaceList() ast.Expr {
+	var items []ast.Expr
+	for {
+		p.skipSpace()
+		t := p.peek()
+		if t == nil || isOp(t, ",") || isOp(t, ")") {
+			break
+		}
+		items = append(items, p.term())
+	}
+
+	if len(items) == 0 {
+		return nil
+	} else if len(items) == 1 {
+		return items[0]
+	}
+	return &ast.List{
+		Span:  joinSpans(items[0].Location(), items[len(items)-1].Location()),
+		Items: items,
+	}
+}
+
+// isBreak reports whether a token can't be part of a word
+func isBreak(t *lexer.Token) bool {
+	if t == nil {
+		return true
+	} else if t.Type == DelimToken {
+		return strings.Contains("(),:", t.Value)
+	}
+	return t.Type == WhitespaceToken || t.Type == StringToken || t.Type == BadStringToken ||
+		t.Type == FunctionToken || t.Type == URLToken || t.Type == BadURLToken
+}
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// term parses a single item in a list. It always consumes at least one token.
+func (p *exprParser) term() ast.Expr {
+	first := p.next()
+
+	if first.Type == StringToken || first.Type == BadStringToken {
+		return &ast.Literal{Span: p.b.span(first, first), Kind: ast.String, Value: first.Value}
+	} else if first.Type == URLToken || first.Type == BadURLToken {
+		return &ast.Literal{Span: p.b.span(first, first), Kind: ast.URL, Value: first.Value}
+	} else if first.Type == FunctionToken {
+		return p.call(first)
+	} else if isOp(first, "(") {
+		x := p.commaList()
+		p.skipSpace()
+		last := p.next()
+		if last == nil {
+			// Unterminated; stop at the last token
+			last = p.toks[len(p.toks)-1]
+		}
+		return &ast.Paren{Span: p.b.span(first, last), X: x}
+	}
+
+	// Anything else is a word made up of adjacent tokens
+	last := first
+	if !isBreak(first) {
+		for !isBreak(p.peek()) {
+			last = p.next()
+		}
+	}
+	span := p.b.span(first, last)
+	word := p.b.text(span)
+
+	if len(word) > 1 && word[0] == '$' {
+		return &ast.Variable{Span: span, Name: word[1:]}
+	} else if numberPattern.MatchString(word) {
+		return &ast.Literal{Span: span, Kind: ast.Number, Value: word}
+	} else if colorPattern.MatchString(word) {
+		return &ast.Literal{Span: span, Kind: ast.Color, Value: word}
+	}
+	return &ast.Literal{Span: span, Kind: ast.Ident, Value: word}
+}
+
+// call parses the arguments to a function. The function token, which
+// includes the '(', was just read.
+func (p *exprParser) call(first *lexer.Token) ast.Expr {
+	rv := &ast.Call{Name: strings.TrimSuffix(first.Value, "(")}
+
+	last := first
+	for {
+		p.skipSpace()
+		t := p.peek()
+		if t == nil {
+			// Unterminated; stop at the last token
+			if len(rv.Args) > 0 {
+				rv.Span = joinSpans(p.b.span(first, first), rv.Args[len(rv.Args)-1].Location())
+				return rv
+			}
+			break
+		} else if isOp(t, ")") {
+			last = p.next()
+			break
+		} else if isOp(t, ",") {
+			p.next()
+			continue
+		}
+
+		if arg := p.argument(); arg != nil {
+			rv.Args = append(rv.Args, arg)
+		}
+	}
+
+	rv.Span = p.b.span(first, last)
+	return rv
+}
+
+// argument parses a single argument in a function call
+func (p *exprParser) argument() ast.Expr {
+	t := p.peek()
+	if t.Type == VariableToken {
+		start := p.i
+		p.next()
+		p.skipSpace()
+		if isOp(p.peek(), ":") {
+			colon := p.next()
+			rv := &ast.KeywordArg{Name: t.Value[1:], Value: p.spaceList()}
+			rv.Span = p.b.span(t, colon)
+			if rv.Value != nil {
+				rv.Span = joinSpans(rv.Span, rv.Value.Location())
+			}
+			return rv
+		}
+		p.i = start
+	}
+
+	return p.spaceList()
+}
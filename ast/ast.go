@@ -0,0 +1,249 @@
+// Package ast declares the types used to represent the syntax tree of an SCSS
+// stylesheet. Use scss.ParseAST to obtain one.
+//
+// Every node records the part of the source it was parsed from, so the tree
+// can be used to write lint rules or to rewrite a stylesheet in place.
+package ast
+
+import (
+	"fmt"
+)
+
+// A Position is a location in a source file. Both lines and columns count from
+// 1; columns count runes. Offset is the byte offset, counting from 0.
+type Position struct {
+	Line, Column int
+	Offset       int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Before reports whether p comes before q
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Column < q.Column)
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// A Span is a range of source text. End points just past the last character.
+type Span struct {
+	File       string
+	Start, End Position
+}
+
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+// Contains reports whether p lies within the span
+func (s Span) Contains(p Position) bool {
+	return !p.Before(s.Start) && p.Before(s.End)
+}
+
+func (s Span) String() string {
+	file := s.File
+	if file == "" {
+		file = "-"
+	}
+	if !s.IsValid() {
+		return file
+	}
+	return file + ":" + s.Start.String()
+}
+
+// All nodes in the tree implement Node
+type Node interface {
+	// Location returns the part of the source the node was parsed from
+	Location() Span
+}
+
+// A Statement is anything that can appear in a block: a Rule, a
+// Declaration, an AtRule or a Comment.
+type Statement interface {
+	Node
+	stmtNode()
+}
+
+// An Expr is (part of) a property value or the parameters of an @-rule
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// A Stylesheet is the root of the tree
+type Stylesheet struct {
+	Span       Span
+	Statements []Statement
+}
+
+// A Block is a list of statements in curly braces
+type Block struct {
+	Span       Span
+	Statements []Statement
+}
+
+// A Rule is a style rule, such as "a, b { color: red; }"
+type Rule struct {
+	Span      Span
+	Selectors []*Selector
+	Block     *Block
+
+	// Comments holds the comments in the selector list, in source order.
+	// Those inside a selector are part of its Text as well.
+	Comments []*Comment
+}
+
+// A Selector is one of the comma-separated selectors of a Rule
+type Selector struct {
+	Span Span
+
+	// Text is the selector as it appears in the source, with all whitespace
+	// collapsed to a single space. A line comment is still followed by a
+	// line break.
+	Text string
+}
+
+// A Declaration sets a property, as in "color: red"
+type Declaration struct {
+	Span     Span
+	Property string
+	Colon    Position
+	Value    Expr
+
+	// Comments holds the comments between the property and the ';' that
+	// ends the declaration, in source order
+	Comments []*Comment
+}
+
+// An AtRule is an @-directive, such as "@import 'foo';"
+type AtRule struct {
+	Span Span
+
+	// Name is the name of the directive, without the '@'
+	Name string
+
+	// Params holds the arguments, or nil if there are none
+	Params Expr
+
+	// Block is nil for directives that end in a semicolon
+	Block *Block
+
+	// Comments holds the comments between the name and the block or the
+	// ';', in source order
+	Comments []*Comment
+}
+
+// A Comment is either a /* block comment */ or a // line comment
+type Comment struct {
+	Span Span
+
+	// Text holds the comment as it appears in the source, including the
+	// comment markers
+	Text string
+}
+
+// LitKind is the kind of value in a Literal
+type LitKind int
+
+const (
+	Ident LitKind = iota
+	Number
+	String
+	Color
+	URL
+)
+
+func (k LitKind) String() string {
+	if k == Ident {
+		return "Ident"
+	} else if k == Number {
+		return "Number"
+	} else if k == String {
+		return "String"
+	} else if k == Color {
+		return "Color"
+	} else if k == URL {
+		return "URL"
+	} else {
+		return fmt.Sprintf("LitKind(%d)", int(k))
+	}
+}
+
+// A Literal is a single word, number, string, colour or url(). Anything else
+// that doesn't fit in one of the other nodes, such as a stray operator, is
+// also represented as an Ident.
+type Literal struct {
+	Span Span
+	Kind LitKind
+
+	// Value holds the literal as it appears in the source; strings include
+	// their quotes.
+	Value string
+}
+
+// A Variable is a reference to a variable, as in "$width"
+type Variable struct {
+	Span Span
+
+	// Name is the name of the variable, without the '$'
+	Name string
+}
+
+// A Call is a function call, as in "darken($c, 10%)"
+type Call struct {
+	Span Span
+	Name string
+	Args []Expr
+}
+
+// A KeywordArg is a named argument in a Call, as in "$inline: true"
+type KeywordArg struct {
+	Span Span
+
+	// Name is the name of the parameter, without the '$'
+	Name  string
+	Value Expr
+}
+
+// A List is a space- or comma-separated list
+type List struct {
+	Span  Span
+	Items []Expr
+	Comma bool
+}
+
+// A Paren is an expression in parentheses
+type Paren struct {
+	Span Span
+	X    Expr
+}
+
+func (n *Stylesheet) Location() Span  { return n.Span }
+func (n *Block) Location() Span       { return n.Span }
+func (n *Rule) Location() Span        { return n.Span }
+func (n *Selector) Location() Span    { return n.Span }
+func (n *Declaration) Location() Span { return n.Span }
+func (n *AtRule) Location() Span      { return n.Span }
+func (n *Comment) Location() Span     { return n.Span }
+func (n *Literal) Location() Span     { return n.Span }
+func (n *Variable) Location() Span    { return n.Span }
+func (n *Call) Location() Span        { return n.Span }
+func (n *KeywordArg) Location() Span  { return n.Span }
+func (n *List) Location() Span        { return n.Span }
+func (n *Paren) Location() Span       { return n.Span }
+
+func (*Rule) stmtNode()        {}
+func (*Declaration) stmtNode() {}
+func (*AtRule) stmtNode()      {}
+func (*Comment) stmtNode()     {}
+
+func (*Literal) exprNode()    {}
+func (*Variable) exprNode()   {}
+func (*Call) exprNode()       {}
+func (*KeywordArg) exprNode() {}
+func (*List) exprNode()       {}
+func (*Paren) exprNode()      {}
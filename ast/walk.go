@@ -0,0 +1,122 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order, in the same order as the
+// nodes appear in the source.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Stylesheet:
+		walkStatements(v, n.Statements)
+
+	case *Block:
+		walkStatements(v, n.Statements)
+
+	case *Rule:
+		var children []Node
+		for _, s := range n.Selectors {
+			children = append(children, s)
+		}
+		if n.Block != nil {
+			children = append(children, n.Block)
+		}
+		walkInOrder(v, children, n.Comments)
+
+	case *Declaration:
+		var children []Node
+		if n.Value != nil {
+			children = append(children, n.Value)
+		}
+		walkInOrder(v, children, n.Comments)
+
+	case *AtRule:
+		var children []Node
+		if n.Params != nil {
+			children = append(children, n.Params)
+		}
+		if n.Block != nil {
+			children = append(children, n.Block)
+		}
+		walkInOrder(v, children, n.Comments)
+
+	case *Call:
+		walkExprs(v, n.Args)
+
+	case *KeywordArg:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *List:
+		walkExprs(v, n.Items)
+
+	case *Paren:
+		if n.X != nil {
+			Walk(v, n.X)
+		}
+
+	case *Selector, *Comment, *Literal, *Variable:
+		// No children
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+// walkInOrder walks the children of a node along with the comments among
+// them, in the order they appear in the source
+func walkInOrder(v Visitor, children []Node, comments []*Comment) {
+	for _, c := range comments {
+		children = append(children, c)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Location().Start.Before(children[j].Location().Start)
+	})
+	for _, n := range children {
+		Walk(v, n)
+	}
+}
+
+func walkExprs(v Visitor, list []Expr) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order. It starts by calling
+// f(node); if f returns true, Inspect invokes f recursively for each of the
+// children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,159 @@
+package scss_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/ast"
+)
+
+const astSource = `// Header
+@import "reset", 'grid';
+
+a, b > .c {
+	color: red;
+	/* nested */
+	.d {
+		background: url(img/bg.png) no-repeat, asset-url("logo.png", $inline: true);
+	}
+	margin: 0 (1px + 2px) #fff;
+}
+`
+
+// dump renders a tree as one line per node, indented by depth
+func dump(n ast.Node) string {
+	var rv strings.Builder
+	depth := 0
+	ast.Inspect(n, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+
+		desc := ""
+		switch n := n.(type) {
+		case *ast.Selector:
+			desc = n.Text
+		case *ast.Declaration:
+			desc = n.Property
+		case *ast.AtRule:
+			desc = n.Name
+		case *ast.Comment:
+			desc = n.Text
+		case *ast.Literal:
+			desc = n.Kind.String() + " " + n.Value
+		case *ast.Variable:
+			desc = n.Name
+		case *ast.Call:
+			desc = n.Name
+		case *ast.KeywordArg:
+			desc = n.Name
+		case *ast.List:
+			desc = fmt.Sprintf("comma=%v", n.Comma)
+		}
+
+		span := n.Location()
+		line := fmt.Sprintf("%s%T %s-%s %s", strings.Repeat("  ", depth), n, span.Start, span.End, desc)
+		rv.WriteString(strings.TrimRight(line, " ") + "\n")
+		depth++
+		return true
+	})
+	return rv.String()
+}
+
+func Test_ParseAST(t *testing.T) {
+	tree, err := scss.ParseAST("test.scss", astSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `*ast.Stylesheet 1:1-12:1
+  *ast.Comment 1:1-1:10 // Header
+  *ast.AtRule 2:1-2:24 import
+    *ast.List 2:9-2:24 comma=true
+      *ast.Literal 2:9-2:16 String "reset"
+      *ast.Literal 2:18-2:24 String 'grid'
+  *ast.Rule 4:1-11:2
+    *ast.Selector 4:1-4:2 a
+    *ast.Selector 4:4-4:10 b > .c
+    *ast.Block 4:11-11:2
+      *ast.Declaration 5:2-5:12 color
+        *ast.Literal 5:9-5:12 Ident red
+      *ast.Comment 6:2-6:14 /* nested */
+      *ast.Rule 7:2-9:3
+        *ast.Selector 7:2-7:4 .d
+        *ast.Block 7:5-9:3
+          *ast.Declaration 8:3-8:78 background
+            *ast.List 8:15-8:78 comma=true
+              *ast.List 8:15-8:40 comma=false
+                *ast.Literal 8:15-8:30 URL url(img/bg.png)
+                *ast.Literal 8:31-8:40 Ident no-repeat
+              *ast.Call 8:42-8:78 asset-url
+                *ast.Literal 8:52-8:62 String "logo.png"
+                *ast.KeywordArg 8:64-8:77 inline
+                  *ast.Literal 8:73-8:77 Ident true
+      *ast.Declaration 10:2-10:28 margin
+        *ast.List 10:10-10:28 comma=false
+          *ast.Literal 10:10-10:11 Number 0
+          *ast.Paren 10:12-10:23
+            *ast.List 10:13-10:22 comma=false
+              *ast.Literal 10:13-10:16 Number 1px
+              *ast.Literal 10:17-10:18 Ident +
+              *ast.Literal 10:19-10:22 Number 2px
+          *ast.Literal 10:24-10:28 Color #fff
+`
+	if got := dump(tree); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if n != nil && n.Location().File != "test.scss" {
+			t.Errorf("%T at %s has the wrong file name", n, n.Location())
+		}
+		return true
+	})
+}
+
+func Test_ParseASTErrors(t *testing.T) {
+	tree, err := scss.ParseAST("test.scss", "a { color: red; }\nb { ; }\nc { color: blue; }\n")
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	rules := 0
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if _, ok := n.(*ast.Rule); ok {
+			rules++
+		}
+		return true
+	})
+	if rules != 3 {
+		t.Errorf("expected all rules to be kept; got %d rules", rules)
+	}
+}
+
+func Test_ParseASTComments(t *testing.T) {
+	// Comments inside a statement belong to that statement
+	tree, err := scss.ParseAST("test.scss", "a, /* x */ b { color: /* c */ red /* d */; }\n/* e */\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `*ast.Stylesheet 1:1-3:1
+  *ast.Rule 1:1-1:45
+    *ast.Selector 1:1-1:2 a
+    *ast.Comment 1:4-1:11 /* x */
+    *ast.Selector 1:12-1:13 b
+    *ast.Block 1:14-1:45
+      *ast.Declaration 1:16-1:34 color
+        *ast.Comment 1:23-1:30 /* c */
+        *ast.Literal 1:31-1:34 Ident red
+        *ast.Comment 1:35-1:42 /* d */
+  *ast.Comment 2:1-2:8 /* e */
+`
+	if got := dump(tree); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	tc "github.com/thijzert/go-termcolours"
+	"log"
+	"os"
+)
+
+// cleanTarget removes the output generated from source, following the same
+// source:target pairs as compiling
+func cleanTarget(source, target string) error {
+	sinf, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if sinf.IsDir() {
+		return descendInto(source, target, cleanTarget)
+	}
+
+	target = cssTarget(target)
+	for _, f := range []string{target, target + ".map"} {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			continue
+		}
+
+		if !isGenerated(f, source) {
+			log.Printf("%s: not removing %s; it wasn't generated by go-scss or it was modified since", source, f)
+			continue
+		}
+
+		if *dryRun {
+			fmt.Printf("    %s %s\n", tc.Yellow("would delete"), f)
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+		forgetOutput(f)
+		fmt.Printf("    %s %s\n", tc.Red("delete"), f)
+	}
+
+	return nil
+}
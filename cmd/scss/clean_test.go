@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Clean(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"src/a.scss":    ".a { x: y; }\n",
+		"src/b.scss":    ".b { x: y; }\n",
+		"src/c.scss":    ".c { x: y; }\n",
+		"src/d.scss":    ".d { x: y; }\n",
+		"out/d.css":     "/* written by hand */\n",
+		"out/other.css": "/* written by hand */\n",
+	})
+	defer os.RemoveAll(dir)
+	src, out := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+
+	compileArgs(t, filepath.Join(src, "a.scss")+":"+out+"/a", filepath.Join(src, "b.scss")+":"+out+"/b", filepath.Join(src, "c.scss")+":"+out+"/c")
+
+	// b.css is modified after it was generated, and c.css is replaced by a
+	// file with the same contents, which is fine to remove
+	writeFiles(t, dir, map[string]string{"out/b.css": readOutput(t, filepath.Join(out, "b.css")) + "/* edited */\n"})
+	writeFiles(t, dir, map[string]string{"out/c.css": readOutput(t, filepath.Join(out, "c.css"))})
+	expected := map[string]string{
+		"a.css":     "missing",
+		"b.css":     readOutput(t, filepath.Join(out, "b.css")),
+		"c.css":     "missing",
+		"d.css":     "/* written by hand */\n",
+		"other.css": "/* written by hand */\n",
+	}
+
+	*dryRun = true
+	if err := cleanTarget(src, out); err != nil {
+		t.Fatal(err)
+	}
+	*dryRun = false
+	if css := readOutput(t, filepath.Join(out, "a.css")); css == "missing" {
+		t.Errorf("a.css was removed during a dry run")
+	}
+
+	if err := cleanTarget(src, out); err != nil {
+		t.Fatal(err)
+	}
+	saveManifests()
+	for name, contents := range expected {
+		if got := readOutput(t, filepath.Join(out, name)); got != contents {
+			t.Errorf("%s: expected %q, got %q", name, contents, got)
+		}
+	}
+
+	// The manifest only lists the file that was left behind
+	manifests = make(map[string]*manifest)
+	m := manifestFor(filepath.Join(out, "b.css"))
+	if len(m.Files) != 1 {
+		t.Errorf("expected only b.css in the manifest, got %v", m.Files)
+	}
+
+	// A file that happens to have the same name as the output of a different
+	// source is left alone too
+	writeFiles(t, dir, map[string]string{"other/a.scss": ".a { x: y; }\n"})
+	compileArgs(t, filepath.Join(src, "a.scss")+":"+out+"/a")
+	if err := cleanTarget(filepath.Join(dir, "other", "a.scss"), out+"/a"); err != nil {
+		t.Fatal(err)
+	}
+	if css := readOutput(t, filepath.Join(out, "a.css")); css == "missing" {
+		t.Errorf("a.css was generated from a different source, but it was removed")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// writeDeps writes the dependency files requested by --deps-file and
+// --deps-json, listing every entry file that was compiled or found up to date
+func writeDeps() {
+	if *depsFile != "" {
+		if err := writeFileAtomic(*depsFile, makeDeps()); err != nil {
+			reportError(*depsFile, err)
+		}
+	}
+	if *depsJSON != "" {
+		contents, err := jsonDeps()
+		if err == nil {
+			err = writeFileAtomic(*depsJSON, contents)
+		}
+		if err != nil {
+			reportError(*depsJSON, err)
+		}
+	}
+}
+
+// buildSources returns the entry files of all builds, sorted
+func buildSources() []string {
+	rv := make([]string, 0, len(builds))
+	for source := range builds {
+		rv = append(rv, source)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// imports returns the files an entry file imports, directly or indirectly
+func (b *build) imports(source string) []string {
+	rv := []string{}
+	for _, dep := range b.deps {
+		if dep != source {
+			rv = append(rv, dep)
+		}
+	}
+	return rv
+}
+
+// makeDeps returns a Makefile fragment with a rule for every output file,
+// depending on its source and everything it imports. Like `gcc -MP`, every
+// import also gets an empty rule, so make doesn't fail when one is removed.
+func makeDeps() string {
+	var buf bytes.Buffer
+	phony := make(map[string]bool)
+	for _, source := range buildSources() {
+		b := builds[source]
+		targets := []string{cssTarget(b.target)}
+		if options.SourceMap.Enabled && !options.SourceMap.Inline {
+			targets = append(targets, targets[0]+".map")
+		}
+
+		for i, t := range targets {
+			targets[i] = makeEscape(t)
+		}
+		fmt.Fprintf(&buf, "%s: %s", strings.Join(targets, " "), makeEscape(source))
+		for _, dep := range b.imports(source) {
+			fmt.Fprintf(&buf, " \\\n  %s", makeEscape(dep))
+			phony[dep] = true
+		}
+		buf.WriteString("\n")
+	}
+
+	deps := make([]string, 0, len(phony))
+	for dep := range phony {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	for _, dep := range deps {
+		fmt.Fprintf(&buf, "\n%s:\n", makeEscape(dep))
+	}
+	return buf.String()
+}
+
+// makeEscape escapes a file name for use in a Makefile rule
+func makeEscape(name string) string {
+	name = strings.Replace(name, "$", "$$", -1)
+	name = strings.Replace(name, "#", "\\#", -1)
+	name = strings.Replace(name, " ", "\\ ", -1)
+	return name
+}
+
+// depsEntry is how an entry file appears in the output of --deps-json
+type depsEntry struct {
+	Output  string   `json:"output"`
+	Imports []string `json:"imports"`
+}
+
+// jsonDeps returns a JSON object that maps every entry file onto its output
+// file and the files it imports
+func jsonDeps() (string, error) {
+	graph := make(map[string]depsEntry)
+	for source, b := range builds {
+		graph[source] = depsEntry{
+			Output:  cssTarget(b.target),
+			Imports: b.imports(source),
+		}
+	}
+
+	// Maps are marshalled with sorted keys, so the output is stable
+	contents, err := json.MarshalIndent(graph, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return string(contents) + "\n", nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_JSONDeps(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"a.scss":       "@import 'shared';\n@import 'only-a';\n.a { x: y; }\n",
+		"b.scss":       "@import 'shared';\n.b { x: y; }\n",
+		"c.scss":       ".c { x: y; }\n",
+		"_shared.scss": ".shared { x: y; }\n",
+		"_only-a.scss": "@import 'nested';\n",
+		"_nested.scss": ".nested { x: y; }\n",
+	})
+	defer os.RemoveAll(dir)
+	in := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	compileArgs(t, in("a.scss")+":"+in("out/a"), in("b.scss")+":"+in("out/b"), in("c.scss")+":"+in("out/c"))
+
+	contents, err := jsonDeps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graph map[string]struct {
+		Output  string   `json:"output"`
+		Imports []string `json:"imports"`
+	}
+	if err := json.Unmarshal([]byte(contents), &graph); err != nil {
+		t.Fatalf("expected a JSON object, got %s", contents)
+	}
+
+	// Every entry only lists its own imports, in the order they were loaded
+	expected := map[string][]string{
+		"a.scss": {in("_shared.scss"), in("_only-a.scss"), in("_nested.scss")},
+		"b.scss": {in("_shared.scss")},
+		"c.scss": {},
+	}
+	if len(graph) != len(expected) {
+		t.Errorf("expected %d entries, got %s", len(expected), contents)
+	}
+	for name, imports := range expected {
+		e, ok := graph[in(name)]
+		if !ok {
+			t.Errorf("%s: missing from %s", name, contents)
+			continue
+		}
+		if e.Output != in("out/"+name[:1]+".css") {
+			t.Errorf("%s: expected output %s, got %s", name, in("out/"+name[:1]+".css"), e.Output)
+		}
+		if !reflect.DeepEqual(e.Imports, imports) {
+			t.Errorf("%s: expected imports %v, got %v", name, imports, e.Imports)
+		}
+	}
+}
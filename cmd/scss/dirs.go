@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// subdirMode determines how subdirectories are handled when compiling a
+// directory
+type subdirMode int
+
+const (
+	// mirrorSubdirs compiles subdirectories into matching subdirectories of
+	// the target
+	mirrorSubdirs subdirMode = iota
+
+	// flattenSubdirs writes the output for all subdirectories into the
+	// target directory itself
+	flattenSubdirs
+
+	// skipSubdirs ignores subdirectories altogether
+	skipSubdirs
+)
+
+func (m subdirMode) String() string {
+	if m == mirrorSubdirs {
+		return "mirror"
+	} else if m == flattenSubdirs {
+		return "flatten"
+	} else if m == skipSubdirs {
+		return "skip"
+	} else {
+		return fmt.Sprintf("subdirMode(%d)", int(m))
+	}
+}
+
+func (m *subdirMode) Set(s string) error {
+	for _, v := range []subdirMode{mirrorSubdirs, flattenSubdirs, skipSubdirs} {
+		if s == v.String() {
+			*m = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode '%s'; expected 'mirror', 'flatten' or 'skip'", s)
+}
+
+var (
+	subdirs  subdirMode
+	includes stringList
+	excludes stringList
+)
+
+// descendInto calls action for every stylesheet in sourceDir that should be
+// compiled on its own, and for those in its subdirectories depending on the
+// --subdirs flag. Partials (files whose name starts with an underscore) and
+// anything that isn't a .scss file are skipped, as are files that
+// don't match the --include and --exclude patterns.
+func descendInto(sourceDir, targetDir string, action func(source, target string) error) error {
+	return walkDir(sourceDir, targetDir, "", action)
+}
+
+// walkDir implements descendInto. rel is the path of sourceDir relative to
+// the directory given on the command line.
+func walkDir(sourceDir, targetDir, rel string, action func(source, target string) error) error {
+	d, err := os.Open(sourceDir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name[0] == '.' {
+			continue
+		}
+
+		source := path.Join(sourceDir, name)
+		relName := path.Join(rel, name)
+		if matchAny(excludes, relName) {
+			continue
+		}
+
+		sinf, err := os.Stat(source)
+		if err != nil {
+			reportError(source, err)
+			continue
+		}
+
+		if sinf.IsDir() {
+			if subdirs == skipSubdirs {
+				continue
+			}
+			sub := targetDir
+			if subdirs == mirrorSubdirs {
+				sub = path.Join(targetDir, name)
+			}
+			if err := walkDir(source, sub, relName, action); err != nil {
+				reportError(source, err)
+			}
+			continue
+		}
+
+		if !isEntryFile(name) || (len(includes) > 0 && !matchAny(includes, relName)) {
+			continue
+		}
+
+		if err := action(source, path.Join(targetDir, name)); err != nil {
+			reportError(source, err)
+		}
+	}
+
+	return nil
+}
+
+// isEntryFile reports whether a file in a directory should be compiled on its
+// own
+func isEntryFile(name string) bool {
+	if strings.HasPrefix(name, "_") {
+		return false
+	}
+	return path.Ext(name) == ".scss"
+}
+
+// matchAny reports whether either the relative path or the base name of a
+// file matches any of the glob patterns
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
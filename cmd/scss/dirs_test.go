@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_DescendInto(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"a.scss":              "",
+		"_partial.scss":       "",
+		"indented.sass":       "",
+		"plain.css":           "",
+		".hidden.scss":        "",
+		"sub/b.scss":          "",
+		"sub/deeper/c.scss":   "",
+		"vendor/d.scss":       "",
+		"vendor/e.scss":       "",
+		"sub/vendor/f.scss":   "",
+		"sub/_g.scss":         "",
+		".git/objects/h.scss": "",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		subdirs  subdirMode
+		includes stringList
+		excludes stringList
+		expected string
+	}{
+		{mirrorSubdirs, nil, nil, "a:a sub/b:sub/b sub/deeper/c:sub/deeper/c sub/vendor/f:sub/vendor/f vendor/d:vendor/d vendor/e:vendor/e"},
+		{flattenSubdirs, nil, nil, "a:a sub/b:b sub/deeper/c:c sub/vendor/f:f vendor/d:d vendor/e:e"},
+		{skipSubdirs, nil, nil, "a:a"},
+
+		// Patterns match the relative path as well as the base name
+		{mirrorSubdirs, nil, stringList{"vendor"}, "a:a sub/b:sub/b sub/deeper/c:sub/deeper/c"},
+		{mirrorSubdirs, nil, stringList{"sub/vendor"}, "a:a sub/b:sub/b sub/deeper/c:sub/deeper/c vendor/d:vendor/d vendor/e:vendor/e"},
+		{mirrorSubdirs, nil, stringList{"*/e.scss", "sub/*/*"}, "a:a sub/b:sub/b vendor/d:vendor/d"},
+		{mirrorSubdirs, stringList{"vendor/*"}, nil, "vendor/d:vendor/d vendor/e:vendor/e"},
+		{mirrorSubdirs, stringList{"[abc].scss"}, nil, "a:a sub/b:sub/b sub/deeper/c:sub/deeper/c"},
+		{mirrorSubdirs, stringList{"[abc].scss"}, stringList{"deeper"}, "a:a sub/b:sub/b"},
+
+		// Included files are only found in directories that aren't excluded
+		{skipSubdirs, stringList{"sub/b.scss"}, nil, ""},
+		{mirrorSubdirs, stringList{"*.scss"}, stringList{"*"}, ""},
+	}
+
+	defer func() {
+		subdirs, includes, excludes = mirrorSubdirs, nil, nil
+	}()
+	for _, test := range tests {
+		subdirs, includes, excludes = test.subdirs, test.includes, test.excludes
+
+		var found []string
+		err := descendInto(dir, "out", func(source, target string) error {
+			rel, err := filepath.Rel(dir, source)
+			if err != nil {
+				return err
+			}
+			rel = strings.TrimSuffix(filepath.ToSlash(rel), ".scss")
+			found = append(found, rel+":"+strings.TrimSuffix(strings.TrimPrefix(target, "out/"), ".scss"))
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s, include %v, exclude %v: unexpected error: %v", test.subdirs, test.includes, test.excludes, err)
+		} else if strings.Join(found, " ") != test.expected {
+			t.Errorf("%s, include %v, exclude %v: expected %q, got %q", test.subdirs, test.includes, test.excludes, test.expected, strings.Join(found, " "))
+		}
+	}
+}
+
+func Test_CSSTarget(t *testing.T) {
+	tests := []struct {
+		target, expected string
+	}{
+		{"a.scss", "a.css"},
+		{"dir/a", "dir/a.css"},
+		{"a.css", "a.css"},
+		{"a.sass", "a.sass.css"},
+		{"a.min", "a.min.css"},
+	}
+	for _, test := range tests {
+		if got := cssTarget(test.target); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.target, test.expected, got)
+		}
+	}
+}
+
+func Test_AddEntries(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"a.scss":   "",
+		"b.css":    "",
+		"c.sass":   "",
+		"d/e.scss": "",
+	})
+	defer os.RemoveAll(dir)
+	in := func(name string) string {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+
+	tests := []struct {
+		source, target string
+		err            string
+	}{
+		{"a.scss", "a.scss", ""},
+		{"b.css", "out/b", ""},
+		{"b.css", "b.css", "overwrite the source file"},
+		{"b.css", "b", "overwrite the source file"},
+		{"c.sass", "c", "not supported"},
+		{"d", "d", ""},
+		{"missing.scss", "missing.scss", "no such file"},
+	}
+	for _, test := range tests {
+		list, err := addEntries(nil, in(test.source), in(test.target))
+		if test.err == "" {
+			if err != nil || len(list) != 1 {
+				t.Errorf("%s:%s: expected one entry, got %d and error %v", test.source, test.target, len(list), err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) || len(list) != 0 {
+			t.Errorf("%s:%s: expected an error containing %q, got %d entries and error %v", test.source, test.target, test.err, len(list), err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/format"
+	"github.com/thijzert/go-scss/internal/diff"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fmtMain implements the 'fmt' subcommand, which works much like gofmt
+func fmtMain(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "Write the result to the source file instead of standard output")
+	list := fs.Bool("l", false, "List files whose formatting differs from the canonical style")
+	showDiff := fs.Bool("d", false, "Display diffs instead of rewriting files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s fmt [flags] [path ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *write {
+			reportError("-", fmt.Errorf("can't use -w on standard input"))
+			return
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			reportError("-", err)
+			return
+		}
+		if err := formatFile("<standard input>", src, *list, false, *showDiff); err != nil {
+			reportError("-", err)
+		}
+		return
+	}
+
+	for _, arg := range fs.Args() {
+		err := filepath.Walk(arg, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			base := filepath.Base(name)
+			if name != arg && base[0] == '.' {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || (name != arg && !strings.HasSuffix(name, ".scss")) {
+				return nil
+			}
+
+			src, err := ioutil.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			if err := formatFile(name, src, *list, *write, *showDiff); err != nil {
+				reportError(name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			reportError(arg, err)
+		}
+	}
+}
+
+// formatFile formats a single stylesheet, and does whatever the flags say with
+// the result
+func formatFile(name string, src []byte, list, write, showDiff bool) error {
+	out, err := format.Source(name, src)
+	if err != nil {
+		if _, ok := err.(scss.ErrorList); ok {
+			return compileFailure(scss.Diagnose(err, name, string(src)))
+		}
+		return err
+	}
+
+	if string(out) == string(src) {
+		if !list && !write && !showDiff {
+			os.Stdout.Write(out)
+		}
+		return nil
+	}
+
+	if list {
+		fmt.Println(name)
+	}
+	if write {
+		if err := writeFileAtomic(name, string(out)); err != nil {
+			return err
+		}
+	}
+	if showDiff {
+		fmt.Print(diff.Unified(name+".orig", name, string(src), string(out)))
+	}
+	if !list && !write && !showDiff {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/thijzert/go-scss"
+	"io"
+	"os"
+	"path"
+	"runtime"
+)
+
+// An entry is a single stylesheet to compile
+type entry struct {
+	source string
+
+	// target is the target as given on the command line, before adding the
+	// .css suffix
+	target string
+
+	res scss.Result
+	err error
+
+	// out holds the compiled stylesheet until it is put in place. It is nil
+	// if the output goes to standard output instead.
+	out *atomicFile
+
+	done chan struct{}
+}
+
+// addEntries appends the stylesheets to compile from source to the list.
+// Source can be a file or a directory. With --update, stylesheets that are up
+// to date are left out.
+func addEntries(list []*entry, source, target string) ([]*entry, error) {
+	if source == "-" {
+		return append(list, &entry{source: source, target: target, done: make(chan struct{})}), nil
+	}
+
+	sinf, err := os.Stat(source)
+	if err != nil {
+		return list, err
+	}
+	if sinf.IsDir() {
+		sourceDirs = append(sourceDirs, sourceDir{source, target})
+		err = descendInto(source, target, func(source, target string) error {
+			var err error
+			list, err = addEntries(list, source, target)
+			return err
+		})
+		return list, err
+	}
+
+	if path.Ext(source) == ".sass" {
+		return list, fmt.Errorf("%s: the indented syntax of .sass files is not supported", source)
+	}
+	if !*toStdout {
+		if tinf, err := os.Stat(cssTarget(target)); err == nil && os.SameFile(sinf, tinf) {
+			return list, fmt.Errorf("%s: the output would overwrite the source file", source)
+		}
+	}
+
+	if *act_update && !*toStdout {
+		css := cssTarget(target)
+		deps, ok := upToDate(css, source)
+		if ok && options.SourceMap.Enabled && !options.SourceMap.Inline {
+			ok = isGenerated(css+".map", source)
+		}
+		if ok {
+			recordBuild(source, target, deps, nil)
+			return list, nil
+		}
+	}
+
+	return append(list, &entry{source: source, target: target, done: make(chan struct{})}), nil
+}
+
+// compile compiles the entry. Output to a file is streamed into a temporary
+// file next to the target, which finish puts in place; output to standard
+// output is kept in the Result. The source "-" stands for standard input.
+func (e *entry) compile() {
+	if e.source == "-" {
+		e.res, e.err = stdinCompiler.CompileReader(os.Stdin)
+		return
+	} else if *toStdout {
+		e.res, e.err = compiler.CompileFile(e.source)
+		return
+	}
+
+	target := cssTarget(e.target)
+	e.out, e.err = createAtomic(target)
+	if e.err != nil {
+		return
+	}
+	e.res, e.err = compiler.CompileTo(e.out, e.source)
+	if e.err == nil && e.res.SourceMap != nil && !options.SourceMap.Inline {
+		_, e.err = io.WriteString(e.out, scss.SourceMappingURL(path.Base(target)+".map"))
+	}
+	if err := e.out.Close(); e.err == nil {
+		e.err = err
+	}
+}
+
+// compileAll compiles all entries, using as many workers as --jobs says. The
+// compiled stylesheets are written and reported in the order they were given,
+// so the output doesn't depend on which worker happened to finish first.
+func compileAll(entries []*entry) {
+	workers := *jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	queue := make(chan *entry)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for e := range queue {
+				e.compile()
+				close(e.done)
+			}
+		}()
+	}
+	go func() {
+		for _, e := range entries {
+			queue <- e
+		}
+		close(queue)
+	}()
+
+	for _, e := range entries {
+		<-e.done
+		if err := e.finish(); err != nil {
+			reportError(e.source, err)
+		}
+	}
+}
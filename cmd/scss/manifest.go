@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// manifestName is the name of the file, in every directory that we write
+// output to, that keeps track of the files we generated
+const manifestName = ".go-scss.json"
+
+// A manifest lists the files generated in a single directory, so we can tell
+// them apart from files someone else put there
+type manifest struct {
+	dir     string
+	changed bool
+
+	// Files maps the base name of every generated file onto its origin
+	Files map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	// Source is the path of the source file, relative to the directory
+	Source string `json:"source"`
+
+	// Hash is the SHA-256 hash of the contents we wrote
+	Hash string `json:"hash"`
+
+	// Deps maps the source and every file it imports onto the hash of their
+	// contents at the time of compiling. It is only set for stylesheets that
+	// compiled without errors.
+	Deps map[string]string `json:"deps,omitempty"`
+
+	// Options is a fingerprint of the command-line options that affect the
+	// output
+	Options string `json:"options,omitempty"`
+}
+
+// manifests caches all manifests that were loaded, by directory
+var manifests = make(map[string]*manifest)
+
+// manifestFor returns the manifest for the directory containing the file
+// target. If there is none yet, it returns an empty one.
+func manifestFor(target string) *manifest {
+	dir := filepath.Dir(target)
+	if m, ok := manifests[dir]; ok {
+		return m
+	}
+
+	m := &manifest{dir: dir}
+	if contents, err := ioutil.ReadFile(filepath.Join(dir, manifestName)); err == nil {
+		if err := json.Unmarshal(contents, m); err != nil {
+			log.Printf("ignoring %s: %v", filepath.Join(dir, manifestName), err)
+		}
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]manifestEntry)
+	}
+	manifests[dir] = m
+	return m
+}
+
+func hashContents(contents []byte) string {
+	h := sha256.Sum256(contents)
+	return hex.EncodeToString(h[:])
+}
+
+// recordOutput registers target as generated from source. The hash is that of
+// its contents, as returned by hashContents. If deps is not empty, it lists all
+// files involved in compiling it, so --update can tell when it needs to be
+// compiled again.
+func recordOutput(target, source, hash string, deps []string) {
+	m := manifestFor(target)
+	entry := manifestEntry{
+		Source: m.rel(source),
+		Hash:   hash,
+	}
+
+	if len(deps) > 0 {
+		entry.Deps = make(map[string]string)
+		entry.Options = optionsFingerprint()
+		for _, dep := range deps {
+			contents, err := ioutil.ReadFile(dep)
+			if err != nil {
+				entry.Deps = nil
+				break
+			}
+			entry.Deps[m.rel(dep)] = hashContents(contents)
+		}
+	}
+
+	m.Files[filepath.Base(target)] = entry
+	m.changed = true
+}
+
+// rel returns the path of a file relative to the manifest's directory
+func (m *manifest) rel(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		if rel, err := filepath.Rel(absDir(m.dir), abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return name
+}
+
+// upToDate reports whether target was generated from source with the same
+// options, and neither it nor any of the files involved changed since. If so,
+// it also returns those files.
+func upToDate(target, source string) ([]string, bool) {
+	if !isGenerated(target, source) {
+		return nil, false
+	}
+
+	m := manifestFor(target)
+	entry := m.Files[filepath.Base(target)]
+	if entry.Deps == nil || entry.Options != optionsFingerprint() {
+		return nil, false
+	}
+
+	deps := make([]string, 0, len(entry.Deps))
+	for dep, hash := range entry.Deps {
+		name := filepath.Join(m.dir, filepath.FromSlash(dep))
+		contents, err := ioutil.ReadFile(name)
+		if err != nil || hashContents(contents) != hash {
+			return nil, false
+		}
+		deps = append(deps, name)
+	}
+	sort.Strings(deps)
+	return deps, true
+}
+
+// optionsFingerprint summarises all options that affect the output
+func optionsFingerprint() string {
+	return hashContents([]byte(fmt.Sprintf("%s %s %d %v %v %v %q",
+		options.OutputStyle, options.Charset, options.Precision,
+		options.SourceMap.Enabled, options.SourceMap.Inline, options.SourceMap.EmbedSources,
+		options.LoadPaths)))
+}
+
+// forgetOutput removes target from its manifest
+func forgetOutput(target string) {
+	m := manifestFor(target)
+	if _, ok := m.Files[filepath.Base(target)]; ok {
+		delete(m.Files, filepath.Base(target))
+		m.changed = true
+	}
+}
+
+// isGenerated reports whether target is a file we generated from source, and
+// that hasn't been modified since
+func isGenerated(target, source string) bool {
+	m := manifestFor(target)
+	entry, ok := m.Files[filepath.Base(target)]
+	if !ok {
+		return false
+	}
+
+	abs, err := filepath.Abs(source)
+	if err != nil || filepath.Join(absDir(m.dir), filepath.FromSlash(entry.Source)) != abs {
+		return false
+	}
+
+	contents, err := ioutil.ReadFile(target)
+	return err == nil && hashContents(contents) == entry.Hash
+}
+
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// saveManifests writes every manifest that changed. Manifests without any
+// files are removed.
+func saveManifests() {
+	dirs := make([]string, 0, len(manifests))
+	for dir := range manifests {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		m := manifests[dir]
+		if !m.changed {
+			continue
+		}
+		m.changed = false
+
+		name := filepath.Join(dir, manifestName)
+		if len(m.Files) == 0 {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				log.Print(err)
+			}
+			continue
+		}
+
+		contents, err := json.MarshalIndent(m, "", "\t")
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		if err := writeFileAtomic(name, string(contents)+"\n"); err != nil {
+			log.Print(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/thijzert/go-scss"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_UpToDate(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"a.scss":        "@import 'dep';\n.a { x: y; }\n",
+		"_dep.scss":     ".dep { x: y; }\n",
+		"broken.scss":   ".broken {\n",
+		"unrelated.css": "",
+	})
+	defer os.RemoveAll(dir)
+	source, target := filepath.Join(dir, "a.scss"), filepath.Join(dir, "out", "a.css")
+	compileArgs(t, source+":"+target, filepath.Join(dir, "broken.scss")+":"+filepath.Join(dir, "out", "broken.css"))
+	failed = false
+
+	check := func(what string, expected bool) {
+		// Start from the manifest on disk, like the next run would
+		manifests = make(map[string]*manifest)
+		deps, ok := upToDate(target, source)
+		if ok != expected {
+			t.Errorf("%s: expected up to date to be %v", what, expected)
+		} else if ok && len(deps) != 2 {
+			t.Errorf("%s: expected the source and its import, got %v", what, deps)
+		}
+	}
+
+	check("just compiled", true)
+	writeFiles(t, dir, map[string]string{"unrelated.css": "/* changed */"})
+	check("unrelated file changed", true)
+
+	// A stylesheet that failed to compile is never up to date
+	manifests = make(map[string]*manifest)
+	if _, ok := upToDate(filepath.Join(dir, "out", "broken.css"), filepath.Join(dir, "broken.scss")); ok {
+		t.Errorf("failed stylesheet: expected it not to be up to date")
+	}
+
+	writeFiles(t, dir, map[string]string{"_dep.scss": ".dep { x: z; }\n"})
+	check("import changed", false)
+	writeFiles(t, dir, map[string]string{"_dep.scss": ".dep { x: y; }\n"})
+	check("import changed back", true)
+
+	os.Remove(filepath.Join(dir, "_dep.scss"))
+	check("import deleted", false)
+	writeFiles(t, dir, map[string]string{"_dep.scss": ".dep { x: y; }\n"})
+
+	writeFiles(t, dir, map[string]string{"a.scss": "@import 'dep';\n.a { x: z; }\n"})
+	check("source changed", false)
+	writeFiles(t, dir, map[string]string{"a.scss": "@import 'dep';\n.a { x: y; }\n"})
+	check("source changed back", true)
+
+	writeFiles(t, dir, map[string]string{"out/a.css": "/* modified */"})
+	check("output modified", false)
+	compileArgs(t, source+":"+target)
+	check("compiled again", true)
+
+	os.Remove(target)
+	check("output deleted", false)
+	compileArgs(t, source+":"+target)
+	check("compiled again", true)
+}
+
+func Test_OptionsFingerprint(t *testing.T) {
+	defer func() {
+		options = scss.Options{}
+	}()
+
+	options = scss.Options{}
+	base := optionsFingerprint()
+	changes := []struct {
+		what   string
+		change func(o *scss.Options)
+	}{
+		{"output style", func(o *scss.Options) { o.OutputStyle = scss.Compressed }},
+		{"charset", func(o *scss.Options) { o.Charset = scss.CharsetNever }},
+		{"precision", func(o *scss.Options) { o.Precision = 3 }},
+		{"source map", func(o *scss.Options) { o.SourceMap.Enabled = true }},
+		{"inline source map", func(o *scss.Options) { o.SourceMap.Enabled, o.SourceMap.Inline = true, true }},
+		{"embedded sources", func(o *scss.Options) { o.SourceMap.Enabled, o.SourceMap.EmbedSources = true, true }},
+		{"load paths", func(o *scss.Options) { o.LoadPaths = []string{"a", "b"} }},
+		{"load path order", func(o *scss.Options) { o.LoadPaths = []string{"b", "a"} }},
+	}
+
+	seen := map[string]string{base: "defaults"}
+	for _, c := range changes {
+		options = scss.Options{}
+		c.change(&options)
+		fp := optionsFingerprint()
+		if other, ok := seen[fp]; ok {
+			t.Errorf("%s: same fingerprint as %s", c.what, other)
+		}
+		seen[fp] = c.what
+	}
+
+	// Options that don't affect the output don't count
+	options = scss.Options{OnError: scss.KeepTarget}
+	if optionsFingerprint() != base {
+		t.Errorf("on-error: expected the fingerprint not to change")
+	}
+
+	// A changed fingerprint makes the output out of date
+	dir := setup(t, map[string]string{"a.scss": ".a { x: y; }\n"})
+	defer os.RemoveAll(dir)
+	source, target := filepath.Join(dir, "a.scss"), filepath.Join(dir, "a.css")
+	compileArgs(t, source)
+	manifests = make(map[string]*manifest)
+	if _, ok := upToDate(target, source); !ok {
+		t.Fatalf("expected a.css to be up to date")
+	}
+	options.OutputStyle = scss.Compressed
+	manifests = make(map[string]*manifest)
+	if _, ok := upToDate(target, source); ok {
+		t.Errorf("expected a.css to be out of date after changing the output style")
+	}
+}
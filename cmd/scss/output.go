@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// writeFileAtomic replaces the contents of a file in one go, by writing to a
+// temporary file first and renaming it over the target. This way, a web server
+// will never see a half-written stylesheet. The directory is created if it
+// doesn't exist yet.
+func writeFileAtomic(target, contents string) error {
+	f, err := createAtomic(target)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(contents)); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// An atomicFile is written to a temporary file, which replaces the target
+// when it is committed. See writeFileAtomic.
+type atomicFile struct {
+	f      *os.File
+	target string
+	mode   os.FileMode
+	hash   hash.Hash
+	closed bool
+}
+
+// createAtomic starts writing a new version of the target
+func createAtomic(target string) (*atomicFile, error) {
+	mode := os.FileMode(0644)
+	if inf, err := os.Stat(target); err == nil {
+		mode = inf.Mode().Perm()
+	} else if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(path.Dir(target), "."+path.Base(target)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{f: f, target: target, mode: mode, hash: sha256.New()}, nil
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	n, err := a.f.Write(p)
+	a.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the hash of everything written so far, as hashContents would
+func (a *atomicFile) Sum() string {
+	return hex.EncodeToString(a.hash.Sum(nil))
+}
+
+// Close closes the temporary file, so it doesn't hold on to a file descriptor
+// while it waits to be committed. Nothing can be written after this.
+func (a *atomicFile) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	return a.f.Close()
+}
+
+// Commit puts the new contents in place of the target
+func (a *atomicFile) Commit() error {
+	err := a.Close()
+	if err == nil {
+		err = os.Chmod(a.f.Name(), a.mode)
+	}
+	if err == nil {
+		err = os.Rename(a.f.Name(), a.target)
+	}
+
+	if err != nil {
+		os.Remove(a.f.Name())
+	}
+	return err
+}
+
+// Abort throws away the new contents, leaving the target as it was
+func (a *atomicFile) Abort() {
+	a.Close()
+	os.Remove(a.f.Name())
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/thijzert/go-scss"
+	tc "github.com/thijzert/go-termcolours"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// reportError writes an error in the format chosen on the command line
+func reportError(source string, err error) {
+	failed = true
+
+	if *errorFormat == "text" {
+		log.Print(err)
+		return
+	}
+
+	diags, ok := err.(compileFailure)
+	if !ok {
+		// Something other than the stylesheet went wrong, e.g. an I/O error
+		diags = compileFailure{scss.Diagnostic{
+			Span:     scss.Span{File: source},
+			Severity: scss.SeverityError,
+			Code:     scss.ErrIO,
+			Message:  err.Error(),
+		}}
+	}
+	writeJSON(diags)
+}
+
+// reportWarnings writes warnings and debug messages in the format chosen on the
+// command line
+func reportWarnings(diags []scss.Diagnostic) {
+	if *errorFormat == "json" {
+		writeJSON(diags)
+		return
+	}
+
+	for _, d := range diags {
+		if d.Severity == scss.SeverityDebug {
+			log.Printf("%s %s: %s", d.Span, tc.Cyan("debug"), d.Message)
+		} else {
+			log.Print(d.String())
+		}
+	}
+}
+
+// writeJSON writes every diagnostic as a separate object on a single line
+func writeJSON(diags []scss.Diagnostic) {
+	var w io.Writer = os.Stderr
+	if *errorOutput == "stdout" {
+		w = os.Stdout
+	}
+	enc := json.NewEncoder(w)
+	for _, d := range diags {
+		if err := enc.Encode(d); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// compileFailure renders the diagnostics for a file that failed to compile
+type compileFailure []scss.Diagnostic
+
+func (c compileFailure) Error() string {
+	rv := make([]string, len(c))
+	for i, d := range c {
+		rv[i] = d.String()
+	}
+	return strings.Join(rv, "\n")
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/thijzert/go-scss"
 	tc "github.com/thijzert/go-termcolours"
-	"io/ioutil"
 	"log"
 	"os"
 	"path"
@@ -15,106 +15,254 @@ import (
 var (
 	act_compile = flag.Bool("compile", false, "Compile source files or directories")
 	act_version = flag.Bool("version", false, "Show version information")
+	act_clean   = flag.Bool("clean", false, "Remove the CSS and source map files generated from the given sources")
+	act_update  = flag.Bool("update", false, "Only compile files whose output is missing, or older than the source or anything it imports")
+	act_watch   = flag.Bool("watch", false, "After compiling, keep running and recompile whenever a source file or any of its imports changes")
+
+	options   scss.Options
+	loadPaths stringList
+	compiler  *scss.Compiler
+
+	// stdinCompiler compiles standard input. If source maps are enabled,
+	// it embeds them in the output.
+	stdinCompiler *scss.Compiler
+
+	sourceMap       = flag.Bool("source-map", false, "Write a source map next to every output file")
+	inlineSourceMap = flag.Bool("inline-source-map", false, "Embed the source map in the output")
+	embedSources    = flag.Bool("embed-sources", false, "Include the contents of the source files in the source map")
+
+	readStdin = flag.Bool("stdin", false, "Read a stylesheet from standard input and write the CSS to standard output; the same as giving '-' as a source")
+	toStdout  = flag.Bool("stdout", false, "Write the CSS to standard output rather than to files")
+
+	depsFile = flag.String("deps-file", "", "Write a Makefile rule for every output file to this file, listing the files it was compiled from")
+	depsJSON = flag.String("deps-json", "", "Write a JSON object to this file that maps every source file onto its output and the files it imports")
+
+	jobs   = flag.Int("jobs", 1, "Number of stylesheets to compile at the same time; 0 means one for every CPU")
+	dryRun = flag.Bool("dry-run", false, "With --clean, only list the files that would be removed")
+
+	// failed is set when any of the input files could not be compiled
+	failed bool
+
+	errorFormat = flag.String("error-format", "text", "Format for errors and warnings: 'text' or 'json'")
+	errorOutput = flag.String("error-output", "stderr", "Where to write errors and warnings: 'stderr' or 'stdout'")
 )
 
 func init() {
-	flag.Parse()
+	flag.Var(&options.OnError, "on-error", "What to do with the output if a file fails to compile: 'css' writes a stylesheet showing the error, 'keep' leaves the previous output untouched, 'delete' removes it")
+	flag.Var(&options.OutputStyle, "style", "Output style: 'nested', 'expanded' or 'compressed'")
+	flag.Var(&options.Charset, "charset", "When to add a @charset declaration: 'auto', 'always' or 'never'")
+	flag.IntVar(&options.Precision, "precision", 10, "Number of digits after the decimal point")
+	flag.Var(&loadPaths, "load-path", "Directory to search for imports (may be repeated)")
+	flag.Var(&subdirs, "subdirs", "What to do with subdirectories when compiling a directory: 'mirror' compiles them into matching subdirectories of the target, 'flatten' writes all output to the target directory itself, 'skip' ignores them")
+	flag.Var(&includes, "include", "When compiling a directory, only compile files matching this glob pattern (may be repeated)")
+	flag.Var(&excludes, "exclude", "When compiling a directory, skip files and directories matching this glob pattern (may be repeated)")
+}
+
+// configure checks the command-line flags, and sets up the compiler
+func configure() {
+	for _, p := range append(includes, excludes...) {
+		if _, err := path.Match(p, ""); err != nil {
+			log.Fatalf("invalid pattern '%s': %v", p, err)
+		}
+	}
+
+	options.LoadPaths = loadPaths
+	options.SourceMap.Enabled = *sourceMap || *inlineSourceMap
+	options.SourceMap.Inline = *inlineSourceMap || *toStdout
+	options.SourceMap.EmbedSources = *embedSources
+	compiler = scss.NewCompiler(options)
+
+	// There's no file to put the source map for standard input in
+	stdinOptions := options
+	stdinOptions.SourceMap.Inline = true
+	stdinCompiler = scss.NewCompiler(stdinOptions)
+
+	if *errorFormat != "text" && *errorFormat != "json" {
+		log.Fatalf("unknown error format '%s'", *errorFormat)
+	}
+	if *errorOutput != "stderr" && *errorOutput != "stdout" {
+		log.Fatalf("unknown error output '%s'", *errorOutput)
+	}
+	if *errorOutput == "stdout" {
+		log.SetOutput(os.Stdout)
+	}
 
-	// TODO: implement other actions, e.g. "--clean", "--watch", etc.
-	if !*act_compile && !*act_version {
+	if !*act_compile && !*act_version && !*act_clean {
 		*act_compile = true
 	}
 }
 
 func main() {
+	if isSubcommand("fmt") {
+		// The subcommand parses its own flags
+		fmtMain(os.Args[2:])
+	} else {
+		flag.Parse()
+		configure()
+		run()
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// run does whatever the command-line flags ask for
+func run() {
 	if *act_version {
 		fmt.Printf("go-scss Version %d.%d.%d.%d\n", scss.Version.Release, scss.Version.Breaking, scss.Version.Feature, scss.Version.Fix)
-	} else if *act_compile {
+	} else if *act_clean {
 		for _, a := range flag.Args() {
-			aa := strings.Split(a, ":")
-			source := aa[0]
-			target := aa[0]
-			if len(aa) > 1 {
-				target = aa[1]
+			source, target := splitArg(a)
+			if err := cleanTarget(source, target); err != nil {
+				reportError(source, err)
 			}
+		}
+		saveManifests()
+	} else if *act_compile {
+		args := flag.Args()
+		if *readStdin {
+			args = append([]string{"-"}, args...)
+		}
 
-			err := compileTo(source, target)
+		var entries []*entry
+		for _, a := range args {
+			source, target := splitArg(a)
+
+			var err error
+			entries, err = addEntries(entries, source, target)
 
 			if err != nil {
-				log.Print(err)
+				reportError(source, err)
 				continue
 			}
 		}
-	}
-}
-
-func descendInto(sourceDir, targetDir string) error {
-	d, err := os.Open(sourceDir)
-	if err != nil {
-		return err
-	}
-	defer d.Close()
+		compileAll(entries)
+		saveManifests()
+		writeDeps()
 
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		return err
-	}
-
-	for _, name := range names {
-		if name[0] == '.' {
-			continue
-		}
-
-		err := compileTo(path.Join(sourceDir, name), path.Join(targetDir, name))
-		if err != nil {
-			log.Print(err)
+		if *act_watch {
+			watch()
 		}
 	}
+}
 
-	return nil
+// isSubcommand reports whether the program was started as "scss name". Only
+// the very first argument counts, so a file with the same name can still be
+// compiled by putting a flag before it, as in "scss --compile fmt".
+func isSubcommand(name string) bool {
+	return len(os.Args) > 1 && os.Args[1] == name
 }
 
-func compileTo(source, target string) error {
-	sinf, err := os.Stat(source)
-	if err != nil {
-		return err
-	}
-	if sinf.IsDir() {
-		return descendInto(source, target)
+// splitArg splits a command-line argument into a source and a target
+func splitArg(a string) (source, target string) {
+	aa := strings.Split(a, ":")
+	source = aa[0]
+	target = aa[0]
+	if len(aa) > 1 {
+		target = aa[1]
 	}
+	return
+}
 
-	// Add the .css suffix
-	if len(target) > 5 && target[len(target)-5:] == ".scss" {
-		target = target[:len(target)-5] + ".css"
-	} else if len(target) > 4 && target[len(target)-4:] == ".css" {
-		target = target + ".css"
-	}
+// finish writes the output of a compiled entry, and reports any warnings. It
+// returns the compilation error, if any.
+func (e *entry) finish() error {
+	source, origTarget := e.source, e.target
+	target := cssTarget(origTarget)
 
-	nf, err := os.Create(target)
-	if err != nil {
-		return err
+	res, rerr := e.res, e.err
+	if source != "-" {
+		recordBuild(source, origTarget, res.LoadedFiles, res.MissingFiles)
+	}
+	reportWarnings(res.Warnings)
+	if rerr != nil {
+		if _, ok := rerr.(scss.ErrorList); !ok {
+			// The source file itself couldn't be read, or the output
+			// couldn't be written
+			if e.out != nil {
+				e.out.Abort()
+			}
+			return rerr
+		}
+		rerr = compileFailure(scss.Diagnose(rerr, source, ""))
 	}
-	defer nf.Close()
 
-	src, err := ioutil.ReadFile(source)
-	if err != nil {
-		return err
+	if *toStdout || source == "-" {
+		if rerr == nil || options.OnError == scss.ErrorCSS {
+			if _, err := os.Stdout.WriteString(res.CSS); err != nil {
+				return err
+			}
+		}
+		return rerr
 	}
 
-	cmp, rerr := scss.Compile(string(src))
+	if rerr != nil {
+		if options.OnError == scss.KeepTarget {
+			e.out.Abort()
+			return rerr
+		} else if options.OnError == scss.DeleteTarget {
+			e.out.Abort()
+			for _, f := range []string{target, target + ".map"} {
+				if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+					log.Print(err)
+				}
+				forgetOutput(f)
+			}
+			return rerr
+		}
+	}
 
-	i := 0
-	for i < len(cmp) {
-		n, err := nf.WriteString(cmp[i:])
+	if res.SourceMap != nil && !options.SourceMap.Inline {
+		res.SourceMap.File = path.Base(target)
+		res.SourceMap.RelativeTo(path.Dir(target))
+		sm, err := json.Marshal(res.SourceMap)
+		if err == nil {
+			err = writeFileAtomic(target+".map", string(sm))
+		}
 		if err != nil {
+			e.out.Abort()
 			return err
 		}
-		i += n
+		recordOutput(target+".map", source, hashContents(sm), nil)
 	}
 
+	if err := e.out.Commit(); err != nil {
+		return err
+	}
 	if rerr == nil {
+		recordOutput(target, source, e.out.Sum(), res.LoadedFiles)
+	} else {
+		recordOutput(target, source, e.out.Sum(), nil)
+	}
+
+	if rerr == nil && *errorFormat == "text" {
 		fmt.Printf("    %s %s\n", tc.Green("write"), target)
 	}
 
 	return rerr
 }
+
+// cssTarget replaces the .scss suffix of a target file name by .css. Any other
+// name gets .css appended, unless it already ends in .css.
+func cssTarget(target string) string {
+	ext := path.Ext(target)
+	if ext == ".scss" {
+		return target[:len(target)-len(ext)] + ".css"
+	} else if ext == ".css" {
+		return target
+	}
+	return target + ".css"
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_StdinSourceMap(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"a.scss":     ".a { x: y; }\n",
+		"stdin.scss": ".stdin { x: y; }\n",
+	})
+	defer os.RemoveAll(dir)
+
+	defer func() {
+		flag.CommandLine.Parse([]string{"--source-map=false"})
+		configure()
+	}()
+
+	// Standard input and output are files for the duration of the test
+	stdin, err := os.Open(filepath.Join(dir, "stdin.scss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(dir, "stdout.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	origStdin, origStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() {
+		os.Stdin, os.Stdout = origStdin, origStdout
+	}()
+
+	// Only the output to standard output gets an inline source map
+	flag.CommandLine.Parse([]string{"--source-map", "-", filepath.Join(dir, "a.scss")})
+	configure()
+	run()
+	os.Stdin, os.Stdout = origStdin, origStdout
+
+	if css := readOutput(t, filepath.Join(dir, "stdout.css")); !strings.Contains(css, ".stdin") || !strings.Contains(css, "sourceMappingURL=data:") {
+		t.Errorf("standard output: expected an inline source map, got %q", css)
+	}
+	if css := readOutput(t, filepath.Join(dir, "a.css")); !strings.Contains(css, "sourceMappingURL=a.css.map") {
+		t.Errorf("a.css: expected a link to the source map, got %q", css)
+	}
+	if sm := readOutput(t, filepath.Join(dir, "a.css.map")); !strings.Contains(sm, "a.scss") {
+		t.Errorf("a.css.map: got %q", sm)
+	}
+}
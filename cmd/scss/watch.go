@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	tc "github.com/thijzert/go-termcolours"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// pollInterval is the time between two checks for changed files
+	pollInterval = 250 * time.Millisecond
+
+	// debounce is how long the files have to stay unchanged before anything
+	// is recompiled, so that a burst of changes leads to a single recompile
+	debounce = 300 * time.Millisecond
+)
+
+// A build records how an entry file was compiled
+type build struct {
+	// target is the target as given on the command line, before adding the
+	// .css suffix
+	target string
+
+	// deps lists the entry file and everything it imports
+	deps []string
+
+	// missing lists the files that imports which couldn't be found might
+	// refer to
+	missing []string
+}
+
+// files lists the files whose changes can affect the build
+func (b *build) files() []string {
+	rv := make([]string, 0, len(b.deps)+len(b.missing))
+	rv = append(rv, b.deps...)
+	return append(rv, b.missing...)
+}
+
+// builds maps every entry file onto its latest build
+var builds = make(map[string]*build)
+
+// recordBuild remembers which files were involved in compiling an entry file
+func recordBuild(source, target string, loaded, missing []string) {
+	deps := loaded
+	if len(deps) == 0 {
+		deps = []string{source}
+	}
+	builds[source] = &build{target: target, deps: deps, missing: missing}
+}
+
+// A sourceDir is a directory given on the command line, along with its target
+type sourceDir struct {
+	source, target string
+}
+
+// sourceDirs lists the directories given on the command line, which are
+// watched for new entry files
+var sourceDirs []sourceDir
+
+// A watcher keeps track of changes to the files involved in the builds
+type watcher struct {
+	// mtimes holds the modification times of the files at the last check
+	mtimes map[string]time.Time
+
+	// pending holds the files that changed since the last recompile
+	pending map[string]bool
+
+	// added maps new entry files onto their targets
+	added map[string]string
+
+	lastChange time.Time
+}
+
+func newWatcher() *watcher {
+	return &watcher{
+		mtimes:  statWatched(),
+		pending: make(map[string]bool),
+		added:   make(map[string]string),
+	}
+}
+
+// watch polls all entry files and their imports, and recompiles the entry
+// files affected by any change. Directories are checked for new entry files.
+// It never returns.
+func watch() {
+	w := newWatcher()
+	fmt.Printf("Watching %d files for changes. Press Ctrl+C to stop.\n", len(w.mtimes))
+
+	for {
+		time.Sleep(pollInterval)
+		w.poll(time.Now())
+	}
+}
+
+// poll checks for changes. Once nothing changed for the debounce time, it
+// recompiles the affected entry files and reports whether it did.
+func (w *watcher) poll(now time.Time) bool {
+	current := statWatched()
+	for name, mtime := range current {
+		if old, ok := w.mtimes[name]; !ok || !old.Equal(mtime) {
+			w.pending[name] = true
+			w.lastChange = now
+		}
+	}
+	for name := range w.mtimes {
+		if _, ok := current[name]; !ok {
+			w.pending[name] = true
+			w.lastChange = now
+		}
+	}
+	w.mtimes = current
+
+	for _, d := range sourceDirs {
+		descendInto(d.source, d.target, func(source, target string) error {
+			if _, ok := builds[source]; !ok && w.added[source] == "" {
+				w.added[source] = target
+				w.lastChange = now
+			}
+			return nil
+		})
+	}
+
+	if (len(w.pending) == 0 && len(w.added) == 0) || now.Sub(w.lastChange) < debounce {
+		return false
+	}
+
+	for _, source := range affectedEntries(w.pending) {
+		recompile(source, builds[source].target)
+	}
+	for _, source := range sortedKeys(w.added) {
+		recompile(source, w.added[source])
+	}
+	saveManifests()
+	writeDeps()
+	w.pending = make(map[string]bool)
+	w.added = make(map[string]string)
+
+	// The imports may have changed as well
+	w.mtimes = statWatched()
+	return true
+}
+
+// statWatched returns the modification times of all files involved in any of
+// the builds, including missing imports once they appear. Files that don't
+// exist (anymore) are left out.
+func statWatched() map[string]time.Time {
+	rv := make(map[string]time.Time)
+	for _, b := range builds {
+		for _, name := range b.files() {
+			if _, ok := rv[name]; ok {
+				continue
+			}
+			if inf, err := os.Stat(name); err == nil {
+				rv[name] = inf.ModTime()
+			}
+		}
+	}
+	return rv
+}
+
+// affectedEntries returns the entry files that import any of the changed
+// files, directly or indirectly, or failed to import them
+func affectedEntries(changed map[string]bool) []string {
+	var rv []string
+	for source, b := range builds {
+		for _, name := range b.files() {
+			if changed[name] {
+				rv = append(rv, source)
+				break
+			}
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]string) []string {
+	rv := make([]string, 0, len(m))
+	for k := range m {
+		rv = append(rv, k)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// recompile compiles an entry file again, and reports how long it took
+func recompile(source, target string) {
+	started := time.Now()
+	e := &entry{source: source, target: target}
+	e.compile()
+	err := e.finish()
+	elapsed := tc.Cyan(time.Since(started).Round(time.Millisecond).String())
+
+	if err != nil {
+		fmt.Printf("    %s %s %s\n", tc.Red("error"), source, elapsed)
+		reportError(source, err)
+		return
+	}
+	fmt.Printf("    %s %s %s\n", tc.Green("done"), source, elapsed)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/thijzert/go-scss"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setup creates a temporary directory to compile in, and resets the state left
+// behind by other tests. The caller should remove the directory.
+func setup(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, files)
+
+	options = scss.Options{}
+	compiler = scss.NewCompiler(options)
+	builds = make(map[string]*build)
+	manifests = make(map[string]*manifest)
+	sourceDirs = nil
+	failed = false
+	return dir
+}
+
+// writeFiles creates files in dir. Slashes in the names separate directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// compileArgs compiles source:target pairs like the command line does
+func compileArgs(t *testing.T, args ...string) {
+	var entries []*entry
+	for _, a := range args {
+		source, target := splitArg(a)
+		var err error
+		if entries, err = addEntries(entries, source, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compileAll(entries)
+	saveManifests()
+}
+
+// readOutput returns the contents of a file, or "missing" if it doesn't exist
+func readOutput(t *testing.T, name string) string {
+	contents, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "missing"
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func Test_Watch(t *testing.T) {
+	dir := setup(t, map[string]string{
+		"src/a.scss":       "@import 'b';\n.a { x: y; }\n",
+		"src/_shared.scss": ".c { x: y; }\n",
+		"src/c.scss":       "@import 'shared';\n",
+	})
+	defer os.RemoveAll(dir)
+	options.OnError = scss.KeepTarget
+	compiler = scss.NewCompiler(options)
+
+	src, out := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+	compileArgs(t, src+":"+out)
+	if !failed {
+		t.Errorf("expected a.scss to fail, as it imports a missing file")
+	}
+	if css := readOutput(t, filepath.Join(out, "c.css")); !strings.Contains(css, ".c") {
+		t.Fatalf("c.css: got %q", css)
+	}
+
+	w := newWatcher()
+	now := time.Now()
+	if w.poll(now) {
+		t.Errorf("recompiled without any changes")
+	}
+
+	// Creating the missing import fixes a.scss, and a new entry file gets
+	// compiled as well
+	writeFiles(t, dir, map[string]string{
+		"src/_b.scss": ".b { x: y; }\n",
+		"src/d.scss":  ".d { x: y; }\n",
+	})
+	if w.poll(now) {
+		t.Errorf("recompiled before the changes settled")
+	}
+	now = now.Add(debounce)
+	if !w.poll(now) {
+		t.Fatalf("expected a recompile")
+	}
+	if css := readOutput(t, filepath.Join(out, "a.css")); !strings.Contains(css, ".b") || !strings.Contains(css, ".a") {
+		t.Errorf("a.css: got %q", css)
+	}
+	if css := readOutput(t, filepath.Join(out, "d.css")); !strings.Contains(css, ".d") {
+		t.Errorf("d.css: got %q", css)
+	}
+
+	// The new import is watched from now on
+	writeFiles(t, dir, map[string]string{"src/_b.scss": ".bb { x: y; }\n"})
+	later := now.Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(src, "_b.scss"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	w.poll(now)
+	now = now.Add(debounce)
+	if !w.poll(now) {
+		t.Fatalf("expected a recompile")
+	}
+	if css := readOutput(t, filepath.Join(out, "a.css")); !strings.Contains(css, ".bb") {
+		t.Errorf("a.css: got %q", css)
+	}
+
+	// Nothing is left to do
+	if w.poll(now.Add(debounce)) {
+		t.Errorf("recompiled without any changes")
+	}
+	failed = false
+}
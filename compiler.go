@@ -2,63 +2,672 @@ package scss
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 )
 
+// Compile compiles a stylesheet with the default options. If this fails, the
+// output contains a stylesheet that displays the error; see OnError.
 func Compile(src string) (string, error) {
-	parseTree, err := Parse(src)
+	res, err := NewCompiler(Options{}).CompileString(src)
+	return res.CSS, err
+}
+
+// A Compiler compiles stylesheets using a fixed set of Options.
+//
+// A Compiler is safe for concurrent use by multiple goroutines, except that
+// RegisterFunction must not be called while a compilation is running. It
+// keeps the parsed contents of every file it loads, so that a file imported
+// by many stylesheets is only parsed once. Calls to the Logger are
+// serialised, but Importers and custom Functions may be called concurrently.
+type Compiler struct {
+	opts      Options
+	importers []Importer
+	functions map[string]*customFunction
+
+	// err is set if the Options are invalid. It is returned by every call to
+	// one of the Compile methods.
+	err error
+
+	// cache maps file names onto their most recently parsed contents
+	cacheMu sync.Mutex
+	cache   map[string]parsedFile
+
+	logMu sync.Mutex
+}
+
+// A parsedFile is a cached result of parsing a file. The IR is shared
+// between compilations, so it must not be modified.
+type parsedFile struct {
+	src string
+	ir  IR
+	err error
+}
+
+// NewCompiler creates a Compiler
+func NewCompiler(opts Options) *Compiler {
+	if opts.Precision <= 0 {
+		opts.Precision = 10
+	}
+
+	rv := &Compiler{opts: opts}
+	rv.importers = append(rv.importers, fileImporter{})
+	rv.importers = append(rv.importers, opts.Importers...)
+	if len(opts.LoadPaths) > 0 {
+		rv.importers = append(rv.importers, fileImporter{opts.LoadPaths})
+	}
+
+	for sig, fn := range opts.Functions {
+		if err := rv.RegisterFunction(sig, fn); err != nil && rv.err == nil {
+			rv.err = err
+		}
+	}
+	return rv
+}
+
+// RegisterFunction makes a Go function available to stylesheets. The
+// signature lists its name and parameters in Sass syntax, for example
+// "asset-url($path, $inline: false)". Functions should be registered before
+// the Compiler is first used.
+func (c *Compiler) RegisterFunction(signature string, fn Function) error {
+	f, err := parseSignature(signature, fn)
 	if err != nil {
-		return formatErrorCSS(err), compileError("Parse error", err)
+		return err
+	}
+	if c.functions == nil {
+		c.functions = make(map[string]*customFunction)
 	}
+	c.functions[f.name] = f
+	return nil
+}
 
-	rv := ""
-	for _, r := range parseTree.Rules {
-		rr, err := compileRule(r, nil, "")
-		if err == nil {
-			rv += rr
-		} else {
-			rv += formatErrorCSS(err)
-			return rv, err
+// Result holds the output of a compilation
+type Result struct {
+	CSS string
+
+	// SourceMap is nil unless source maps are enabled
+	SourceMap *SourceMap
+
+	// LoadedFiles lists the entry file, followed by every file it imports
+	// directly or indirectly.
+	LoadedFiles []string
+
+	// MissingFiles lists the files an import that couldn't be found might
+	// have referred to. Creating any of them may fix the compilation.
+	MissingFiles []string
+
+	Warnings []Diagnostic
+}
+
+// CompileFile compiles the stylesheet in a file. If compilation fails, the
+// error is an ErrorList of Diagnostics. The Result will still list the files
+// that were loaded and any warnings, and its CSS depends on Options.OnError.
+func (c *Compiler) CompileFile(filename string) (Result, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Result{}, err
+	}
+	return c.compile(filename, string(src))
+}
+
+// CompileTo compiles the stylesheet in a file, and writes the CSS to w. Every
+// style rule is written as soon as it is compiled rather than collected in a
+// string, so the CSS in the Result is empty. With CharsetAuto, the first 64
+// KiB of output may be held back until it contains a character that isn't
+// ASCII; this only happens if the rules aren't plain ASCII or call custom
+// functions. If compilation fails, the output written so far stays in place,
+// followed by the stylesheet showing the error if Options.OnError says so.
+func (c *Compiler) CompileTo(w io.Writer, filename string) (Result, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Result{}, err
+	}
+	return c.compileTo(w, filename, string(src))
+}
+
+// CompileString compiles a stylesheet. It takes its file name from Options.
+func (c *Compiler) CompileString(src string) (Result, error) {
+	return c.compile(c.opts.Filename, src)
+}
+
+// CompileReader reads and compiles a stylesheet. It takes its file name from
+// Options.
+func (c *Compiler) CompileReader(r io.Reader) (Result, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	return c.compile(c.opts.Filename, string(src))
+}
+
+// A compilation holds the state of a single call to one of the Compile methods
+type compilation struct {
+	c      *Compiler
+	result Result
+	errs   ErrorList
+
+	// sources holds the contents of every file loaded
+	sources map[string]string
+
+	// importStack lists the files currently being loaded, to catch loops
+	importStack []string
+
+	// rules holds the rules of all files, with the @imports resolved
+	rules        []Rule
+	plainImports []string
+
+	out emitter
+}
+
+// A block is a style rule with its selector and property values evaluated,
+// ready to be written
+type block struct {
+	rule     *Rule
+	depth    int
+	selector string
+	values   []string
+}
+
+// compile compiles a stylesheet, and returns the CSS in the Result
+func (c *Compiler) compile(filename, src string) (Result, error) {
+	var buf strings.Builder
+	res, err := c.compileTo(&buf, filename, src)
+	res.CSS = buf.String()
+	if errs, ok := err.(ErrorList); ok {
+		// Leave out the output from before the error was found
+		res.CSS = ""
+		if c.opts.OnError == ErrorCSS {
+			res.CSS = formatErrorCSS(errs)
 		}
 	}
-	return rv, nil
+	return res, err
 }
 
-func formatErrorCSS(err error) string {
-	errtext := err.Error()
-	if perr, ok := err.(CompileError); ok {
-		errtext = perr.String()
-	} else if perr, ok := err.(ParseError); ok {
-		errtext = perr.String()
+func (c *Compiler) compileTo(w io.Writer, filename, src string) (Result, error) {
+	if c.err != nil {
+		return Result{}, c.err
+	}
+
+	cc := &compilation{
+		c:       c,
+		sources: make(map[string]string),
 	}
-	return fmt.Sprintf("body:before { font-family: fixed; white-space: pre; content: \"%s\"; }", strings.Replace(strings.Replace(errtext, "\\", "\\\\", -1), "\"", "\\\"", -1))
+
+	cc.out = newEmitter(w, c.opts.SourceMap.Enabled)
+	cc.load(filename, src)
+
+	if len(cc.errs) == 0 {
+		cc.start()
+		for i := range cc.rules {
+			r := &cc.rules[i]
+			if err := cc.compileRule(r, nil, 0); err != nil {
+				cc.fail(err, r.Span.File)
+				break
+			}
+		}
+	}
+
+	if len(cc.errs) > 0 {
+		if c.opts.OnError == ErrorCSS {
+			cc.out.release(false)
+			cc.out.write(formatErrorCSS(cc.errs))
+		}
+		cc.out.flush()
+		return cc.result, cc.errs
+	}
+
+	err := cc.finish()
+	return cc.result, err
 }
 
-func compileRule(rule Rule, prevSelector Selector, indent string) (string, error) {
-	rv := ""
+// load parses a file, and adds its rules to the compilation. Imports are
+// loaded recursively.
+func (cc *compilation) load(filename, src string) {
+	cc.sources[filename] = src
+	if filename != "" {
+		cc.result.LoadedFiles = append(cc.result.LoadedFiles, filename)
+	}
+
+	ir, err := cc.c.parse(filename, src)
+	if err != nil {
+		cc.fail(err, filename)
+		return
+	}
+
+	cc.importStack = append(cc.importStack, filename)
+	defer func() {
+		cc.importStack = cc.importStack[:len(cc.importStack)-1]
+	}()
+
+	for _, r := range ir.Rules {
+		if r.AtRule == nil || r.AtRule.Name != "import" {
+			cc.rules = append(cc.rules, r)
+			continue
+		}
+
+		for _, arg := range r.AtRule.Args {
+			if isPlainImport(arg) {
+				cc.plainImports = append(cc.plainImports, arg)
+			} else if err := cc.importFile(unquote(arg), r.Span); err != nil {
+				cc.fail(err, filename)
+			}
+		}
+	}
+}
+
+// parse parses a file, or returns the cached result if its contents haven't
+// changed since it was last parsed
+func (c *Compiler) parse(filename, src string) (IR, error) {
+	c.cacheMu.Lock()
+	pf, ok := c.cache[filename]
+	c.cacheMu.Unlock()
+	if ok && pf.src == src {
+		return pf.ir, pf.err
+	}
+
+	ir, err := parseFile(filename, src)
+
+	c.cacheMu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]parsedFile)
+	}
+	c.cache[filename] = parsedFile{src, ir, err}
+	c.cacheMu.Unlock()
+
+	return ir, err
+}
+
+// fail records an error that occurred in one of the loaded files
+func (cc *compilation) fail(err error, filename string) {
+	for _, d := range Diagnose(err, filename, cc.sources[filename]) {
+		cc.errs = append(cc.errs, d)
+	}
+}
+
+func (cc *compilation) importFile(url string, from Span) error {
+	var path string
+	var src []byte
+	var err error
+	for _, imp := range cc.c.importers {
+		path, src, err = imp.Import(url, from.File)
+		if err != nil {
+			return compileErrorAt(ErrIO, "Error reading '"+url+"'", err, from)
+		} else if path != "" {
+			break
+		}
+	}
+
+	if path == "" {
+		for _, imp := range cc.c.importers {
+			if f, ok := imp.(fileImporter); ok {
+				cc.result.MissingFiles = append(cc.result.MissingFiles, f.candidates(url, from.File)...)
+			}
+		}
+		return compileErrorAt(ErrImport, "Can't find stylesheet to import: '"+url+"'", nil, from)
+	}
+	for _, p := range cc.importStack {
+		if p == path {
+			return compileErrorAt(ErrImport, "This file is already being imported: '"+path+"'", nil, from)
+		}
+	}
+
+	cc.load(path, string(src))
+	return nil
+}
+
+// compileRule evaluates a rule and its nested rules, and writes them
+func (cc *compilation) compileRule(rule *Rule, prevSelector Selector, depth int) error {
+	if rule.AtRule != nil {
+		return cc.runDirective(*rule)
+	}
 
 	thisSelector, err := composeSelectors(prevSelector, rule.Selector)
 	if err != nil {
-		return "", err
+		return atSpan(err, rule.Span)
 	}
 
 	if len(rule.Scope.Properties) > 0 {
-		rv += indent + thisSelector.Evaluate() + " {\n"
-		for _, p := range rule.Scope.Properties {
-			rv += indent + "\t" + p.Key + ": " + p.Value + ";\n"
+		var sel strings.Builder
+		writeSelector(&sel, thisSelector)
+		b := block{rule, depth, sel.String(), make([]string, len(rule.Scope.Properties))}
+		for i, p := range rule.Scope.Properties {
+			value, err := cc.evaluate(p)
+			if err != nil {
+				return err
+			}
+			b.values[i] = value
 		}
-		rv += indent + "}\n"
+		cc.writeBlock(b)
 	}
 
-	for _, sr := range rule.Scope.Subrules {
-		rr, err := compileRule(sr, thisSelector, indent+"\t")
-		if err == nil {
-			rv += rr
+	for i := range rule.Scope.Subrules {
+		if err := cc.compileRule(&rule.Scope.Subrules[i], thisSelector, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeBlock writes a style rule in the configured output style
+func (cc *compilation) writeBlock(b block) {
+	style := cc.c.opts.OutputStyle
+	indent := ""
+	if style == Nested {
+		indent = strings.Repeat("\t", b.depth)
+	}
+
+	cc.out.write(indent)
+	cc.out.mark(b.rule.Span)
+	cc.out.write(b.selector)
+	if style == Compressed {
+		cc.out.write("{")
+	} else {
+		cc.out.write(" {\n")
+	}
+
+	for i, p := range b.rule.Scope.Properties {
+		if style == Compressed {
+			if i > 0 {
+				cc.out.write(";")
+			}
+			cc.out.mark(p.Span)
+			cc.out.write(p.Key + ":" + b.values[i])
 		} else {
-			rv += formatErrorCSS(err)
-			return rv, err
+			cc.out.write(indent + "\t")
+			cc.out.mark(p.Span)
+			cc.out.write(p.Key + ": " + b.values[i] + ";\n")
+		}
+	}
+
+	if style == Compressed {
+		cc.out.write("}")
+	} else {
+		cc.out.write(indent + "}\n")
+	}
+}
+
+// mayBeNonASCII reports whether the output could contain anything other than
+// plain ASCII. Only the rules and plain imports end up in the output, so
+// comments don't count. Calls to custom functions might return anything.
+func (cc *compilation) mayBeNonASCII() bool {
+	for _, imp := range cc.plainImports {
+		if !isASCII(imp) {
+			return true
+		}
+	}
+	return cc.rulesMayBeNonASCII(cc.rules)
+}
+
+func (cc *compilation) rulesMayBeNonASCII(rules []Rule) bool {
+	for _, r := range rules {
+		for _, t := range r.selector {
+			if !isASCII(t.Value) {
+				return true
+			}
+		}
+		for _, p := range r.Scope.Properties {
+			if !isASCII(p.Key) || !isASCII(p.Value) {
+				return true
+			}
+			for _, t := range p.value {
+				if t.Type == FunctionToken && cc.c.functions[strings.TrimSuffix(t.Value, "(")] != nil {
+					return true
+				}
+			}
+		}
+		if cc.rulesMayBeNonASCII(r.Scope.Subrules) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate computes the final value of a property
+func (cc *compilation) evaluate(p Property) (string, error) {
+	value := p.Value
+	if len(cc.c.functions) > 0 {
+		var err error
+		at := func(start, end int) Span {
+			return valueSpan(p, start, end)
+		}
+		value, err = applyFunctions(value, cc.c.functions, at)
+		if err != nil {
+			return "", compileErrorAt(ErrFunction, "Error evaluating '"+p.Key+"'", err, p.Span)
 		}
 	}
+	return roundNumbers(value, cc.c.opts.Precision), nil
+}
+
+// valueSpan returns the source location of value[start:end], where value is
+// the Value of p
+func valueSpan(p Property, start, end int) Span {
+	var rv Span
+	pos := 0
+	for _, tok := range p.value {
+		if tok.Type == WhitespaceToken {
+			// Whitespace is collapsed into a single space, except at the start
+			if pos > 0 {
+				pos++
+			}
+			continue
+		}
+
+		next := pos + len(tok.Value)
+		if next > start && pos < end {
+			rv = joinSpans(rv, tokenSpan(tok))
+		}
+		pos = next
+	}
+	return rv
+}
+
+// runDirective handles an @-directive inside the stylesheet
+func (cc *compilation) runDirective(rule Rule) error {
+	at := rule.AtRule
+	if at.Name == "import" {
+		return compileErrorAt(ErrUnsupported, "@import is only supported at the top level", nil, rule.Span)
+	}
+
+	msg := make([]string, len(at.Args))
+	for i, arg := range at.Args {
+		msg[i] = unquote(arg)
+	}
+	d := Diagnostic{
+		Span:     rule.Span,
+		Severity: SeverityWarning,
+		Code:     WarnDirective,
+		Message:  strings.Join(msg, ", "),
+		Snippet:  renderSnippet(cc.sources[rule.Span.File], rule.Span),
+	}
+
+	logger := cc.c.opts.Logger
+	cc.c.logMu.Lock()
+	if at.Name == "debug" {
+		d.Severity = SeverityDebug
+		d.Code = DebugDirective
+		d.Snippet = ""
+		if logger != nil {
+			logger.Debug(d)
+		}
+	} else if logger != nil {
+		logger.Warn(d)
+	}
+	cc.c.logMu.Unlock()
+	cc.result.Warnings = append(cc.result.Warnings, d)
+	return nil
+}
+
+// start writes what comes before the style rules: the charset declaration, if
+// needed, and the plain CSS imports
+func (cc *compilation) start() {
+	opts := cc.c.opts
+	decl := "@charset \"UTF-8\";\n"
+	if opts.OutputStyle == Compressed {
+		decl = "\uFEFF"
+	}
+	if opts.Charset == CharsetAlways {
+		cc.out.declareCharset(decl)
+	} else if opts.Charset == CharsetAuto && cc.mayBeNonASCII() {
+		cc.out.holdUntilNonASCII(decl)
+	}
+
+	for _, imp := range cc.plainImports {
+		cc.out.write("@import " + imp + ";")
+		if opts.OutputStyle != Compressed {
+			cc.out.write("\n")
+		}
+	}
+}
+
+// finish puts together the source map, and writes the rest of the output
+func (cc *compilation) finish() error {
+	opts := cc.c.opts
 
-	return rv, nil
+	// Anything written after the style rules is plain ASCII
+	cc.out.release(false)
+
+	if !opts.SourceMap.Enabled {
+		return cc.out.flush()
+	}
+
+	// Source maps count columns in UTF-16 code units rather than runes
+	cc.out.utf16Columns(cc.sources)
+
+	sm := &SourceMap{
+		Version:  3,
+		Sources:  make([]string, len(cc.out.sources)),
+		Names:    []string{},
+		Mappings: encodeMappings(cc.out.mappings),
+	}
+	for i, src := range cc.out.sources {
+		sm.Sources[i] = src
+		if src == "" {
+			sm.Sources[i] = "stdin"
+		}
+		if opts.SourceMap.EmbedSources {
+			sm.SourcesContent = append(sm.SourcesContent, cc.sources[src])
+		}
+	}
+	cc.result.SourceMap = sm
+
+	if opts.SourceMap.Inline {
+		comment, err := inlineSourceMap(sm)
+		if err != nil {
+			return err
+		}
+		if !cc.out.lineStart {
+			cc.out.write("\n")
+		}
+		cc.out.write(comment)
+	}
+	return cc.out.flush()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote removes the quotes around a string, if it has any, and resolves
+// the escapes inside it. It undoes String.CSS.
+func unquote(s string) string {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+
+	var rv strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			rv.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		j := i
+		for j < len(s) && j-i < 6 && isHexDigit(rune(s[j])) {
+			j++
+		}
+		if j > i {
+			// A code point, optionally followed by a single space
+			n, _ := strconv.ParseUint(s[i:j], 16, 32)
+			if n == 0 || n > unicode.MaxRune || (n >= 0xD800 && n <= 0xDFFF) {
+				n = unicode.ReplacementChar
+			}
+			rv.WriteRune(rune(n))
+			if j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n') {
+				j++
+			}
+			i = j - 1
+		} else if s[i] != '\n' {
+			// An escaped newline is left out altogether
+			rv.WriteByte(s[i])
+		}
+	}
+	return rv.String()
+}
+
+// OnError determines what becomes of the output when a stylesheet fails to
+// compile.
+type OnError int
+
+const (
+	// ErrorCSS replaces the output with a stylesheet that shows the error in
+	// the browser. This is convenient during development.
+	ErrorCSS OnError = iota
+
+	// KeepTarget leaves any previous output untouched
+	KeepTarget
+
+	// DeleteTarget removes any previous output
+	DeleteTarget
+)
+
+func (o OnError) String() string {
+	if o == ErrorCSS {
+		return "css"
+	} else if o == KeepTarget {
+		return "keep"
+	} else if o == DeleteTarget {
+		return "delete"
+	} else {
+		return fmt.Sprintf("OnError(%d)", int(o))
+	}
+}
+
+// Set parses an OnError from its name, so it can be used as a command-line flag
+func (o *OnError) Set(s string) error {
+	for _, v := range []OnError{ErrorCSS, KeepTarget, DeleteTarget} {
+		if s == v.String() {
+			*o = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown error policy '%s'; expected 'css', 'keep' or 'delete'", s)
+}
+
+func formatErrorCSS(err error) string {
+	errtext := err.Error()
+	if perr, ok := err.(CompileError); ok {
+		errtext = perr.String()
+	} else if perr, ok := err.(ParseError); ok {
+		errtext = perr.String()
+	} else if perr, ok := err.(ErrorList); ok {
+		errtext = perr.String()
+	}
+	errtext = strings.Replace(strings.Replace(errtext, "\\", "\\\\", -1), "\"", "\\\"", -1)
+	errtext = strings.Replace(errtext, "\n", "\\A ", -1)
+	return fmt.Sprintf("body:before { font-family: fixed; white-space: pre; content: \"%s\"; }", errtext)
 }
@@ -0,0 +1,360 @@
+package scss_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+)
+
+// countingLogger counts messages. It isn't safe for concurrent use by itself,
+// so this also checks that the Compiler serialises calls to its Logger.
+type countingLogger struct {
+	warnings int
+}
+
+func (l *countingLogger) Warn(d scss.Diagnostic) {
+	l.warnings++
+}
+
+func (l *countingLogger) Debug(d scss.Diagnostic) {}
+
+func Test_ConcurrentCompile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"_shared.scss": ".shared { color: red; .nested { color: blue; } }\n@warn \"shared\";\n",
+		"broken.scss":  "@import \"shared\";\n.a { color: \n",
+	}
+	const n = 20
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("entry%02d.scss", i)] = fmt.Sprintf("@import \"shared\";\n.e%d, .f { width: %dpx; & > p { margin: 0; } }\n", i, i)
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := &countingLogger{}
+	c := scss.NewCompiler(scss.Options{Logger: logger, SourceMap: scss.SourceMapOptions{Enabled: true}})
+
+	// Compile everything once to know what to expect
+	names := []string{"broken.scss"}
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("entry%02d.scss", i))
+	}
+	expected := make([]string, len(names))
+	for i, name := range names {
+		res, err := scss.NewCompiler(scss.Options{SourceMap: scss.SourceMapOptions{Enabled: true}}).CompileFile(filepath.Join(dir, name))
+		expected[i] = fmt.Sprintf("%s\n%v\n%v", res.CSS, res.SourceMap, err)
+	}
+
+	const rounds = 5
+	var wg sync.WaitGroup
+	errs := make(chan string, rounds*len(names))
+	for r := 0; r < rounds; r++ {
+		for i, name := range names {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				res, err := c.CompileFile(filepath.Join(dir, name))
+				if got := fmt.Sprintf("%s\n%v\n%v", res.CSS, res.SourceMap, err); got != expected[i] {
+					errs <- fmt.Sprintf("%s: expected:\n%s\ngot:\n%s", name, expected[i], got)
+				}
+			}(i, name)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for e := range errs {
+		t.Error(e)
+	}
+	if logger.warnings != rounds*n {
+		t.Errorf("expected %d warnings, got %d", rounds*n, logger.warnings)
+	}
+}
+
+func Test_SourceMapColumns(t *testing.T) {
+	// Source maps count UTF-16 code units, so the emoji takes up two columns
+	compile := func(src string) string {
+		res, err := scss.NewCompiler(scss.Options{Charset: scss.CharsetNever, SourceMap: scss.SourceMapOptions{Enabled: true}}).CompileString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.SourceMap.Mappings
+	}
+
+	expected := compile("/* xx */ .a { b: c; }\n.d { e: 'xx'; f: g; }\n")
+	got := compile("/* 😀 */ .a { b: c; }\n.d { e: '😀'; f: g; }\n")
+	if got != expected {
+		t.Errorf("expected mappings %q, got %q", expected, got)
+	}
+}
+
+func Test_CompileTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.scss")
+	bad := filepath.Join(dir, "bad.scss")
+	late := filepath.Join(dir, "late.scss")
+	first := filepath.Join(dir, "first.scss")
+	ioutil.WriteFile(good, []byte("@import 'x.css';\n.é { b: c; .d { e: f } }\n"), 0644)
+	ioutil.WriteFile(bad, []byte(".a { b: c; }\n.d { e: 'f }\n"), 0644)
+
+	// This one fails after the first rule was written. Its output stays in
+	// place, but Compile leaves it out.
+	ioutil.WriteFile(late, []byte(".a { b: c; }\n&d { e: f; }\n"), 0644)
+	ioutil.WriteFile(first, []byte(".a { b: c; }\n"), 0644)
+
+	for _, opts := range []scss.Options{
+		{},
+		{OutputStyle: scss.Compressed, SourceMap: scss.SourceMapOptions{Enabled: true, Inline: true}},
+		{OnError: scss.KeepTarget},
+	} {
+		c := scss.NewCompiler(opts)
+		for _, name := range []string{good, bad, late} {
+			expected, eerr := c.CompileFile(name)
+			if name == late {
+				noMap := opts
+				noMap.SourceMap = scss.SourceMapOptions{}
+				partial, _ := scss.NewCompiler(noMap).CompileFile(first)
+				expected.CSS = partial.CSS + expected.CSS
+			}
+
+			var buf bytes.Buffer
+			res, err := c.CompileTo(&buf, name)
+			if buf.String() != expected.CSS || fmt.Sprint(err) != fmt.Sprint(eerr) {
+				t.Errorf("%s: expected\n%s\n%v\ngot:\n%s\n%v", name, expected.CSS, eerr, buf.String(), err)
+			}
+			if res.CSS != "" {
+				t.Errorf("%s: expected no CSS in the result", name)
+			}
+		}
+	}
+}
+
+// progressWriter is an io.Writer that remembers how much was written to it
+type progressWriter struct {
+	written int
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += len(p)
+	return len(p), nil
+}
+
+func Test_CompileToStreams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The last rule calls a function that records how much output had been
+	// written by then
+	rule := ".a {\n\tb: c;\n}\n"
+	name := filepath.Join(dir, "big.scss")
+	ioutil.WriteFile(name, []byte(strings.Repeat(rule, 10000)+".d { e: written(); }\n"), 0644)
+
+	tests := []struct {
+		charset scss.Charset
+		min     int
+		max     int
+	}{
+		// Only the last few kilobytes may still be buffered
+		{scss.CharsetNever, len(rule)*10000 - 4096, len(rule) * 10000},
+		{scss.CharsetAlways, len(rule)*10000 - 4096, len(rule)*10000 + 20},
+
+		// The output is held back in case the function returns something
+		// that isn't ASCII, but only for the first 64 KiB
+		{scss.CharsetAuto, len(rule)*10000 - 4096, len(rule)*10000 + 20},
+	}
+
+	for _, test := range tests {
+		var w progressWriter
+		var before int
+		c := scss.NewCompiler(scss.Options{
+			Charset: test.charset,
+			Functions: map[string]scss.Function{
+				"written()": func(args []scss.Value) (scss.Value, error) {
+					before = w.written
+					return scss.Number{Value: 1}, nil
+				},
+			},
+		})
+		if _, err := c.CompileTo(&w, name); err != nil {
+			t.Fatal(err)
+		}
+		if before < test.min || before > test.max {
+			t.Errorf("%s: expected %d to %d bytes to be written before the last rule, got %d", test.charset, test.min, test.max, before)
+		}
+		if w.written <= before {
+			t.Errorf("%s: nothing was written after the last rule", test.charset)
+		}
+	}
+}
+
+func Test_CompileErrorSpans(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{".a { b: c; }\n&d { e: f; }\n", "selector 2:1-2:3"},
+		{".a { b: c; }\n@import 'missing';\n", "import 2:1-2:18"},
+		{".a {\n\t.b { c: d; }\n\t@import 'e';\n}\n", "unsupported 3:2-3:13"},
+	}
+
+	for _, test := range tests {
+		_, err := scss.NewCompiler(scss.Options{OnError: scss.KeepTarget}).CompileString(test.src)
+		diags := scss.Diagnose(err, "", test.src)
+		if len(diags) != 1 {
+			t.Errorf("%q: expected one error, got %v", test.src, err)
+			continue
+		}
+		d := diags[0]
+		if got := fmt.Sprintf("%s %s-%s", d.Code, d.Span.Start, d.Span.End); got != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.src, test.expected, got)
+		}
+		if d.Snippet == "" {
+			t.Errorf("%q: expected a snippet", test.src)
+		}
+	}
+}
+
+func Test_OnError(t *testing.T) {
+	src := ".a { b: c; }\n.d { e: \"f; }\n"
+	for _, mode := range []scss.OnError{scss.ErrorCSS, scss.KeepTarget, scss.DeleteTarget} {
+		res, err := scss.NewCompiler(scss.Options{OnError: mode}).CompileString(src)
+		if _, ok := err.(scss.ErrorList); !ok {
+			t.Errorf("%s: expected an ErrorList, got %#v", mode, err)
+		}
+
+		if mode != scss.ErrorCSS {
+			if res.CSS != "" {
+				t.Errorf("%s: expected no output, got %q", mode, res.CSS)
+			}
+			continue
+		}
+
+		// The error is shown in the browser, with the quotes escaped and
+		// the line breaks turned into CSS escapes
+		prefix := "body:before { font-family: fixed; white-space: pre; content: \"Error: Unterminated string\\A "
+		if !strings.HasPrefix(res.CSS, prefix) || strings.Contains(res.CSS, "\n") {
+			t.Errorf("%s: expected an error stylesheet, got %q", mode, res.CSS)
+		}
+		if !strings.Contains(res.CSS, "e: \\\"f; }") || strings.Contains(res.CSS, ".a {") {
+			t.Errorf("%s: expected only the error, with the quote escaped; got %q", mode, res.CSS)
+		}
+	}
+
+	var o scss.OnError
+	for _, s := range []string{"css", "keep", "delete"} {
+		if err := o.Set(s); err != nil || o.String() != s {
+			t.Errorf("%s: got %v, %v", s, o, err)
+		}
+	}
+	if err := o.Set("ignore"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+// nestedStylesheet returns n rules with other rules nested depth levels deep
+// inside them
+func nestedStylesheet(n, depth int) string {
+	rule := ""
+	for i := depth; i > 0; i-- {
+		rule = fmt.Sprintf(".level%d, .alt%d > a { color: red; %s }", i, i, rule)
+	}
+	return strings.Repeat(rule+"\n", n)
+}
+
+// benchmarkCompile compiles src with a new Compiler every time, so nothing
+// comes from its cache of parsed files
+func benchmarkCompile(b *testing.B, src string) {
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scss.NewCompiler(scss.Options{}).CompileString(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompile(b *testing.B) {
+	benchmarkCompile(b, scss.LargeStylesheet(b, 1<<20))
+}
+
+func BenchmarkCompileNested(b *testing.B) {
+	benchmarkCompile(b, nestedStylesheet(200, 8))
+}
+
+// BenchmarkCompileSize compiles ever larger stylesheets. The throughput
+// should stay the same as the output grows; building up the output by
+// concatenating strings made it drop with every step.
+func BenchmarkCompileSize(b *testing.B) {
+	rule := ".a .b {\n\tcolor: red;\n\tmargin: 0 auto;\n}\n"
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20, 4 << 20} {
+		src := strings.Repeat(rule, size/len(rule))
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := scss.Compile(src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCompileTo compares compiling a file to a string with streaming the
+// output. Both use a new Compiler every time, so the file is parsed each time.
+func BenchmarkCompileTo(b *testing.B) {
+	src := scss.LargeStylesheet(b, 1<<20)
+	f, err := ioutil.TempFile("", "go-scss-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(src)
+	f.Close()
+
+	b.Run("Compile", func(b *testing.B) {
+		b.SetBytes(int64(len(src)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			res, err := scss.NewCompiler(scss.Options{}).CompileFile(f.Name())
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.WriteString(ioutil.Discard, res.CSS)
+		}
+	})
+	b.Run("CompileTo", func(b *testing.B) {
+		b.SetBytes(int64(len(src)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := scss.NewCompiler(scss.Options{}).CompileTo(ioutil.Discard, f.Name()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package scss
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thijzert/go-scss/ast"
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// Severity indicates how serious a Diagnostic is
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityDebug
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	} else if s == SeverityWarning {
+		return "warning"
+	} else if s == SeverityDebug {
+		return "debug"
+	} else {
+		return fmt.Sprintf("severity %d", int(s))
+	}
+}
+
+// ErrorCode is a short, stable identifier for a class of errors. Unlike the
+// message text, it will not change between releases.
+type ErrorCode string
+
+const (
+	ErrSyntax        ErrorCode = "syntax"
+	ErrUnexpectedEOF ErrorCode = "unexpected-eof"
+	ErrUnsupported   ErrorCode = "unsupported"
+	ErrSelector      ErrorCode = "selector"
+	ErrCompile       ErrorCode = "compile"
+	ErrIO            ErrorCode = "io"
+	ErrImport        ErrorCode = "import"
+	ErrFunction      ErrorCode = "function"
+
+	// Codes for messages from @warn and @debug
+	WarnDirective  ErrorCode = "warn"
+	DebugDirective ErrorCode = "debug"
+)
+
+// A Position is a location in a source file. Both lines and columns count from 1.
+type Position = ast.Position
+
+// A Span is a range of source text. End points just past the last character.
+type Span = ast.Span
+
+// tokenSpan returns the span covered by a single token
+func tokenSpan(tok *lexer.Token) Span {
+	if tok == nil {
+		return Span{}
+	}
+	return Span{
+		File:  tok.File,
+		Start: Position{Line: tok.Line, Column: tok.Column + 1, Offset: tok.Offset},
+		End:   Position{Line: tok.End.Line, Column: tok.End.Column + 1, Offset: tok.End.Offset},
+	}
+}
+
+// joinSpans returns the span running from the start of a to the end of b
+func joinSpans(a, b Span) Span {
+	if !a.IsValid() {
+		return b
+	} else if !b.IsValid() {
+		return a
+	}
+	return Span{File: a.File, Start: a.Start, End: b.End}
+}
+
+// A Diagnostic is an error or warning tied to a location in the source
+type Diagnostic struct {
+	Span     Span
+	Severity Severity
+	Code     ErrorCode
+	Message  string
+
+	// Causes holds the messages of the errors leading up to this one,
+	// outermost first
+	Causes []string
+
+	// Snippet holds the offending source line, with the span underlined
+	Snippet string
+}
+
+func (d Diagnostic) Error() string {
+	return d.Span.String() + ": " + d.Message
+}
+
+// String renders the diagnostic in the same manner as dart-sass does.
+func (d Diagnostic) String() string {
+	label := "Error"
+	if d.Severity == SeverityWarning {
+		label = "Warning"
+	} else if d.Severity == SeverityDebug {
+		label = "Debug"
+	}
+
+	rv := label + ": " + d.Message + "\n"
+	if d.Snippet != "" {
+		rv += d.Snippet
+	}
+	rv += "  " + d.Span.File
+	if d.Span.File == "" {
+		rv += "-"
+	}
+	if d.Span.IsValid() {
+		rv += " " + d.Span.Start.String()
+	}
+	return rv
+}
+
+// MarshalJSON encodes the diagnostic as a flat object, for the benefit of
+// tools that don't want to know about Spans.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	causes := d.Causes
+	if causes == nil {
+		causes = []string{}
+	}
+	return json.Marshal(struct {
+		File      string    `json:"file"`
+		Line      int       `json:"line"`
+		Column    int       `json:"column"`
+		EndLine   int       `json:"endLine"`
+		EndColumn int       `json:"endColumn"`
+		Severity  string    `json:"severity"`
+		Code      ErrorCode `json:"code"`
+		Message   string    `json:"message"`
+		Causes    []string  `json:"causes"`
+	}{
+		d.Span.File,
+		d.Span.Start.Line,
+		d.Span.Start.Column,
+		d.Span.End.Line,
+		d.Span.End.Column,
+		d.Severity.String(),
+		d.Code,
+		d.Message,
+		causes,
+	})
+}
+
+// Diagnose converts an error returned by Parse or Compile into diagnostics.
+// The file name and source text are used to fill in the location and snippet.
+func Diagnose(err error, filename, src string) []Diagnostic {
+	return diagnose(err, nil, filename, src)
+}
+
+func diagnose(err error, causes []string, filename, src string) []Diagnostic {
+	if err == nil {
+		return nil
+	} else if list, ok := err.(ErrorList); ok {
+		var rv []Diagnostic
+		for _, e := range list {
+			rv = append(rv, diagnose(e, causes, filename, src)...)
+		}
+		return rv
+	}
+
+	d := Diagnostic{
+		Severity: SeverityError,
+		Code:     ErrCompile,
+		Causes:   append([]string(nil), causes...),
+	}
+
+	// Find the most specific message and position in the cause chain
+	for e := err; e != nil; {
+		if d.Message != "" {
+			d.Causes = append(d.Causes, d.Message)
+		}
+
+		var span Span
+		var next error
+		if perr, ok := e.(ParseError); ok {
+			d.Code = perr.Code
+			span = tokenSpan(perr.LastToken)
+			next = perr.Previous
+		} else if cerr, ok := e.(CompileError); ok {
+			d.Code = cerr.Code
+			span = cerr.Span
+			next = cerr.Previous
+		} else if list, ok := e.(ErrorList); ok {
+			return diagnose(list, d.Causes, filename, src)
+		} else if diag, ok := e.(Diagnostic); ok {
+			// This one has already been diagnosed
+			diag.Causes = append(d.Causes, diag.Causes...)
+			return []Diagnostic{diag}
+		}
+		d.Message = e.Error()
+		if span.IsValid() {
+			d.Span = span
+		}
+		e = next
+	}
+
+	if d.Code == ErrUnexpectedEOF {
+		d.Span = eofSpan(src)
+	}
+	d.Span.File = filename
+	d.Snippet = renderSnippet(src, d.Span)
+	return []Diagnostic{d}
+}
+
+// eofSpan returns an empty span at the very end of the source
+func eofSpan(src string) Span {
+	src = strings.TrimRight(src, "\r\n")
+	lines := strings.Split(src, "\n")
+	end := Position{Line: len(lines), Column: utf8.RuneCountInString(lines[len(lines)-1]) + 1, Offset: len(src)}
+	return Span{Start: end, End: end}
+}
+
+// renderSnippet shows the first line of a span, with the span underlined
+func renderSnippet(src string, span Span) string {
+	if !span.IsValid() {
+		return ""
+	}
+
+	lines := strings.Split(src, "\n")
+	if span.Start.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[span.Start.Line-1], "\r")
+
+	// Copy any tabs in front of the span, so the carets line up
+	prefix := ""
+	col := 1
+	for _, r := range line {
+		if col >= span.Start.Column {
+			break
+		}
+		if r == '\t' {
+			prefix += "\t"
+		} else {
+			prefix += " "
+		}
+		col++
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line {
+		width = utf8.RuneCountInString(line) - span.Start.Column + 1
+		if width < 1 {
+			width = 1
+		}
+	}
+
+	lineNo := strconv.Itoa(span.Start.Line)
+	gutter := strings.Repeat(" ", len(lineNo))
+
+	rv := gutter + " ,\n"
+	rv += lineNo + " | " + line + "\n"
+	rv += gutter + " | " + prefix + strings.Repeat("^", width) + "\n"
+	rv += gutter + " '\n"
+	return rv
+}
@@ -0,0 +1,79 @@
+package scss_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/internal/diff"
+)
+
+// diagnosticsGolden holds the rendered text and JSON of every diagnostic in
+// Test_DiagnosticGolden. Run with -update to rewrite it.
+const diagnosticsGolden = "testdata/diagnostics.golden"
+
+func Test_DiagnosticGolden(t *testing.T) {
+	failing := func(args []scss.Value) (scss.Value, error) {
+		return nil, errors.New("$x: expected a number")
+	}
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"syntax error", ".a {\n\tb c;\n}\n"},
+		{"multibyte columns", ".é, .😀 { b: 'ç; }\n"},
+		{"selector error", ".a { b: c; }\n&é { d: e; }\n"},
+		{"cause chain", ".a {\n  b: double(c);\n}\n"},
+		{"multiple lines", ".a {\n  b: c;\n}\n@import 'x',\n  'y';\n"},
+	}
+
+	got := ""
+	for _, test := range tests {
+		c := scss.NewCompiler(scss.Options{
+			Filename:  "in.scss",
+			OnError:   scss.KeepTarget,
+			Functions: map[string]scss.Function{"double($x)": failing},
+		})
+		_, err := c.CompileString(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		got += "== " + test.name + "\n" + diagnosticsText(t, scss.Diagnose(err, "", test.src))
+	}
+
+	// Errors that don't come from the compiler have no position
+	got += "== no position\n" + diagnosticsText(t, scss.Diagnose(errors.New("permission denied"), "in.scss", ""))
+
+	if *update {
+		if err := ioutil.WriteFile(diagnosticsGolden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(diagnosticsGolden)
+	if os.IsNotExist(err) {
+		t.Fatalf("%s doesn't exist; run with -update to create it", diagnosticsGolden)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Unified(diagnosticsGolden, "observed", string(want), got); d != "" {
+		t.Errorf("diagnostics differ:\n%s", d)
+	}
+}
+
+// diagnosticsText renders each diagnostic as text, followed by its JSON
+func diagnosticsText(t *testing.T, diags []scss.Diagnostic) string {
+	rv := ""
+	for _, d := range diags {
+		j, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv += d.String() + "\n" + string(j) + "\n"
+	}
+	return rv
+}
@@ -0,0 +1,225 @@
+package scss
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// An emitter writes the CSS output, keeping track of the current position
+// so it can record source mappings.
+type emitter struct {
+	w *bufio.Writer
+
+	// sourceMap is set if mappings should be recorded. Without it, the
+	// position isn't tracked either.
+	sourceMap bool
+
+	// The current position in the output. Columns are counted in UTF-16
+	// code units, as source maps require.
+	line, column int
+
+	// lineStart is set while nothing has been written since the last newline
+	lineStart bool
+
+	mappings    []mapping
+	sources     []string
+	sourceIndex map[string]int
+
+	// held collects the output while it isn't known yet whether it needs a
+	// charset declaration, which is then written in front of it. It is nil
+	// once the output goes straight to w.
+	held    *strings.Builder
+	charset string
+}
+
+// maxHeld is how much output is held back at most while waiting to find out
+// whether it needs a charset declaration
+const maxHeld = 64 << 10
+
+func newEmitter(w io.Writer, sourceMap bool) emitter {
+	return emitter{w: bufio.NewWriter(w), sourceMap: sourceMap, lineStart: true}
+}
+
+func (e *emitter) write(s string) {
+	if s == "" {
+		return
+	}
+	if e.held != nil && !isASCII(s) {
+		e.release(true)
+	}
+	if e.held != nil {
+		e.held.WriteString(s)
+		if e.held.Len() >= maxHeld {
+			e.release(true)
+		}
+	} else {
+		e.w.WriteString(s)
+	}
+	e.lineStart = s[len(s)-1] == '\n'
+	if !e.sourceMap {
+		return
+	}
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		e.line += strings.Count(s, "\n")
+		e.column = utf16Len(s[i+1:])
+	} else {
+		e.column += utf16Len(s)
+	}
+}
+
+// declareCharset writes a declaration that the output is UTF-8: either an
+// @charset rule on a line of its own, or a byte-order mark. Browsers drop the
+// latter, so it doesn't count towards the position in the mappings. Nothing
+// may have been written yet, other than what's being held.
+func (e *emitter) declareCharset(decl string) {
+	e.w.WriteString(decl)
+	newline := strings.HasSuffix(decl, "\n")
+	if newline {
+		e.line++
+		for i := range e.mappings {
+			e.mappings[i].genLine++
+		}
+	}
+	if e.held == nil || e.held.Len() == 0 {
+		e.lineStart = newline
+	}
+}
+
+// holdUntilNonASCII keeps the output in memory until something other than
+// plain ASCII is written. At that point, the charset declaration decl goes
+// in front of it, and the output is written as usual. Rather than holding on
+// to the output any longer than the first maxHeld bytes, it declares the
+// charset anyway.
+func (e *emitter) holdUntilNonASCII(decl string) {
+	e.held = new(strings.Builder)
+	e.charset = decl
+}
+
+// release writes the output held so far, with the charset declaration in front
+// of it if declare is set
+func (e *emitter) release(declare bool) {
+	if e.held == nil {
+		return
+	}
+	if declare {
+		e.declareCharset(e.charset)
+	}
+	e.w.WriteString(e.held.String())
+	e.held = nil
+}
+
+// flush writes any buffered output. It returns the first error that occurred
+// while writing.
+func (e *emitter) flush() error {
+	e.release(false)
+	return e.w.Flush()
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	rv := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			rv += 2
+		} else {
+			rv++
+		}
+	}
+	return rv
+}
+
+// mark records that the next bit of output was generated from span
+func (e *emitter) mark(span Span) {
+	if !e.sourceMap || !span.IsValid() {
+		return
+	}
+	if e.sourceIndex == nil {
+		e.sourceIndex = make(map[string]int)
+	}
+	idx, ok := e.sourceIndex[span.File]
+	if !ok {
+		idx = len(e.sources)
+		e.sources = append(e.sources, span.File)
+		e.sourceIndex[span.File] = idx
+	}
+	e.mappings = append(e.mappings, mapping{e.line, e.column, idx, span.Start.Line - 1, span.Start.Column - 1, span.Start.Offset})
+}
+
+// utf16Columns converts the source columns of all mappings from runes to
+// UTF-16 code units, using the contents of the source files
+func (e *emitter) utf16Columns(sources map[string]string) {
+	for i, m := range e.mappings {
+		src := sources[e.sources[m.source]]
+		if m.srcOffset > len(src) {
+			continue
+		}
+		start := strings.LastIndex(src[:m.srcOffset], "\n") + 1
+		e.mappings[i].srcColumn = utf16Len(src[start:m.srcOffset])
+	}
+}
+
+// roundNumbers rounds all numbers in a property value to the given number of
+// digits after the decimal point. Only numbers, percentages and dimensions are
+// rounded; strings, url()s and names are left alone.
+func roundNumbers(value string, precision int) string {
+	if strings.IndexByte(value, '.') < 0 {
+		return value
+	}
+
+	var rv strings.Builder
+	l := lexer.New(value, nullState)
+	for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+		if tok.Type == NumberToken || tok.Type == PercentageToken || tok.Type == DimensionToken {
+			rv.WriteString(roundNumber(tok.Value, precision))
+		} else if tok.Type != lexer.ErrorToken {
+			rv.WriteString(tok.Value)
+		}
+	}
+	return rv.String()
+}
+
+// roundNumber rounds the number at the start of a numeric token. The sign,
+// exponent and unit are kept as they are.
+func roundNumber(number string, precision int) string {
+	start := 0
+	if start < len(number) && (number[start] == '+' || number[start] == '-') {
+		start++
+	}
+	end := start
+	for end < len(number) && isDigit(number[end]) {
+		end++
+	}
+	dot := end
+	if end < len(number) && number[end] == '.' {
+		end++
+		for end < len(number) && isDigit(number[end]) {
+			end++
+		}
+	}
+	if end-dot-1 <= precision {
+		return number
+	}
+
+	f, err := strconv.ParseFloat(number[start:end], 64)
+	if err != nil {
+		return number
+	}
+	rv := strconv.FormatFloat(f, 'f', precision, 64)
+	rv = strings.TrimRight(rv, "0")
+	rv = strings.TrimSuffix(rv, ".")
+	if rv == "" {
+		rv = "0"
+	} else if number[start] == '.' && strings.HasPrefix(rv, "0.") {
+		// Leave out the leading zero if the source does
+		rv = rv[1:]
+	}
+	return number[:start] + rv + number[end:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
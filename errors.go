@@ -9,12 +9,51 @@ import (
 type CompileError struct {
 	Message  string
 	Previous error
+	Code     ErrorCode
+	Span     Span
 }
 
 type ParseError struct {
 	Message   string
 	Previous  error
 	LastToken *lexer.Token
+	Code      ErrorCode
+}
+
+// ErrorList collects all errors found in a single file
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	if len(e) == 0 {
+		return "no errors"
+	} else if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0].Error(), len(e)-1)
+}
+
+func (e ErrorList) String() string {
+	rv := make([]string, len(e))
+	for i, err := range e {
+		if perr, ok := err.(ParseError); ok {
+			rv[i] = perr.String()
+		} else if perr, ok := err.(CompileError); ok {
+			rv[i] = perr.String()
+		} else if d, ok := err.(Diagnostic); ok {
+			rv[i] = d.String()
+		} else {
+			rv[i] = err.Error()
+		}
+	}
+	return strings.Join(rv, "\n")
+}
+
+// Err returns the list as an error, or nil if it's empty
+func (e ErrorList) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
 }
 
 func (p ParseError) Error() string {
@@ -26,13 +65,22 @@ func (p ParseError) Cause() error {
 }
 
 func parseError(err string, cause error, lastToken *lexer.Token) error {
-	return ParseError{err, cause, lastToken}
+	code := ErrSyntax
+	if lastToken == nil {
+		code = ErrUnexpectedEOF
+	}
+	return ParseError{err, cause, lastToken, code}
+}
+
+func unsupportedError(err string, lastToken *lexer.Token) error {
+	return ParseError{err, nil, lastToken, ErrUnsupported}
 }
 
 func (p ParseError) String() string {
 	rv := p.Message
 	if p.LastToken != nil {
-		rv = fmt.Sprintf("%s -- at line %d c %d", p.Message, p.LastToken.Line, p.LastToken.Column)
+		pos := tokenSpan(p.LastToken).Start
+		rv = fmt.Sprintf("%s -- at line %d c %d", p.Message, pos.Line, pos.Column)
 	}
 	if p.Previous != nil {
 		if perr, ok := p.Previous.(ParseError); ok {
@@ -53,16 +101,38 @@ func (p CompileError) Cause() error {
 }
 
 func compileError(err string, cause error) error {
-	return CompileError{err, cause}
+	return CompileError{err, cause, ErrCompile, Span{}}
+}
+
+func selectorError(err string, cause error) error {
+	return CompileError{err, cause, ErrSelector, Span{}}
+}
+
+func compileErrorAt(code ErrorCode, err string, cause error, span Span) error {
+	return CompileError{err, cause, code, span}
+}
+
+// atSpan attaches a source location to a compile error, unless it already has one
+func atSpan(err error, span Span) error {
+	if cerr, ok := err.(CompileError); ok && !cerr.Span.IsValid() {
+		cerr.Span = span
+		return cerr
+	}
+	return err
 }
 
 func (p CompileError) String() string {
 	rv := p.Message
+	if p.Span.IsValid() {
+		rv = fmt.Sprintf("%s -- at line %d c %d", p.Message, p.Span.Start.Line, p.Span.Start.Column)
+	}
 	if p.Previous != nil {
 		if perr, ok := p.Previous.(CompileError); ok {
 			return rv + "\n\t" + strings.Replace(perr.String(), "\n", "\n\t", -1)
 		} else if perr, ok := p.Previous.(ParseError); ok {
 			return rv + "\n\t" + strings.Replace(perr.String(), "\n", "\n\t", -1)
+		} else if perr, ok := p.Previous.(ErrorList); ok {
+			return rv + "\n\t" + strings.Replace(perr.String(), "\n", "\n\t", -1)
 		} else {
 			return rv + "\n\t" + strings.Replace(p.Previous.Error(), "\n", "\n\t", -1)
 		}
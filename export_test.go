@@ -0,0 +1,5 @@
+package scss
+
+// LargeStylesheet lets the benchmarks in package scss_test use the same input
+// as the ones in this package
+var LargeStylesheet = largeStylesheet
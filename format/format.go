@@ -0,0 +1,377 @@
+// Package format prints SCSS syntax trees in a canonical style.
+//
+// The canonical style uses tabs for indentation, puts every declaration and
+// every selector in a list on a line of its own, and puts the opening brace of
+// a block on the same line as its selectors. Comments are kept in place, as
+// are single blank lines between statements. Formatting a stylesheet that has
+// already been formatted leaves it unchanged.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/ast"
+)
+
+// Source formats a stylesheet. If it contains syntax errors, it is returned
+// unchanged along with an ErrorList.
+func Source(filename string, src []byte) ([]byte, error) {
+	tree, err := scss.ParseAST(filename, string(src))
+	if err != nil {
+		return src, err
+	}
+
+	var buf bytes.Buffer
+	if err := Node(&buf, tree); err != nil {
+		return src, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Node writes a node to w in the canonical style. Statements and blocks are
+// indented as if they appeared at the top level.
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	if stmt, ok := node.(ast.Statement); ok {
+		p.statements([]ast.Statement{stmt})
+	} else if x, ok := node.(ast.Expr); ok {
+		p.expr(x)
+	} else if s, ok := node.(*ast.Stylesheet); ok {
+		p.statements(s.Statements)
+	} else if b, ok := node.(*ast.Block); ok {
+		p.block(b)
+		p.buf.WriteString("\n")
+	} else if s, ok := node.(*ast.Selector); ok {
+		p.buf.WriteString(selector(s.Text))
+	} else {
+		return fmt.Errorf("format.Node: unexpected node type %T", node)
+	}
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	// pending holds the comments inside the statement being printed that
+	// haven't been printed yet
+	pending []*ast.Comment
+}
+
+func (p *printer) newline() {
+	p.buf.WriteString("\n")
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// statements prints a list of statements, each on a line of its own
+func (p *printer) statements(list []ast.Statement) {
+	var prev ast.Statement
+	for _, s := range list {
+		if prev != nil {
+			_, isComment := s.(*ast.Comment)
+			if isComment && s.Location().Start.Line == prev.Location().End.Line {
+				// Keep trailing comments where they are
+				p.buf.WriteString(" ")
+				p.buf.WriteString(strings.TrimRight(s.(*ast.Comment).Text, " \t\r"))
+				prev = s
+				continue
+			}
+
+			p.buf.WriteString("\n")
+			if blankLineBetween(prev, s) || (p.indent == 0 && isRule(prev) && isRule(s)) {
+				p.buf.WriteString("\n")
+			}
+		}
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+		p.statement(s)
+		prev = s
+	}
+	if prev != nil {
+		p.buf.WriteString("\n")
+	}
+}
+
+// blankLineBetween reports whether there are any empty lines between two
+// consecutive statements in the source
+func blankLineBetween(a, b ast.Statement) bool {
+	return b.Location().Start.Line > a.Location().End.Line+1
+}
+
+func isRule(s ast.Statement) bool {
+	_, ok := s.(*ast.Rule)
+	return ok
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.Rule:
+		p.pending = s.Comments
+		for i, sel := range s.Selectors {
+			if i > 0 {
+				p.buf.WriteString(",")
+				p.lineComments(s.Selectors[i-1].Span.End.Line, sel.Span.Start)
+				p.newline()
+			}
+			p.leadingComments(sel.Span.Start)
+			p.skipComments(sel.Span)
+
+			// Lines after a line comment are indented like the rest of a
+			// statement that continues on the next line
+			for j, line := range strings.Split(selector(sel.Text), "\n") {
+				if j > 0 {
+					p.indent++
+					p.newline()
+					p.indent--
+				}
+				p.buf.WriteString(line)
+			}
+		}
+		p.trailingComments(ast.Position{})
+		p.buf.WriteString(" ")
+		p.block(s.Block)
+
+	case *ast.Declaration:
+		p.pending = s.Comments
+		p.buf.WriteString(s.Property)
+		p.trailingComments(s.Colon)
+		p.buf.WriteString(":")
+		if s.Value != nil {
+			p.buf.WriteString(" ")
+			p.expr(s.Value)
+		}
+		p.trailingComments(ast.Position{})
+		p.buf.WriteString(";")
+
+	case *ast.AtRule:
+		p.pending = s.Comments
+		p.buf.WriteString("@" + s.Name)
+		if s.Params != nil {
+			p.buf.WriteString(" ")
+			p.expr(s.Params)
+		}
+		p.trailingComments(ast.Position{})
+		if s.Block != nil {
+			p.buf.WriteString(" ")
+			p.block(s.Block)
+		} else {
+			p.buf.WriteString(";")
+		}
+
+	case *ast.Comment:
+		p.comment(s)
+	}
+}
+
+func (p *printer) block(b *ast.Block) {
+	if len(b.Statements) == 0 {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	p.buf.WriteString("{\n")
+	p.indent++
+	p.statements(b.Statements)
+	p.indent--
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+	p.buf.WriteString("}")
+}
+
+// comment prints a comment. The lines of a block comment are re-indented to
+// match the current indentation.
+func (p *printer) comment(c *ast.Comment) {
+	lines := strings.Split(c.Text, "\n")
+	p.buf.WriteString(strings.TrimRight(lines[0], " \t\r"))
+
+	// Find the indentation the comment has in the source
+	orig := c.Span.Start.Column - 1
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t\r")
+		p.buf.WriteString("\n")
+		if line == "" {
+			continue
+		}
+
+		// Remove the original indentation, counting tabs as one column, and
+		// add our own
+		i := 0
+		for i < len(line) && i < orig && (line[i] == '\t' || line[i] == ' ') {
+			i++
+		}
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+		p.buf.WriteString(line[i:])
+	}
+}
+
+// leadingComments prints the pending comments that come before pos, each
+// followed by a space
+func (p *printer) leadingComments(pos ast.Position) {
+	for len(p.pending) > 0 && p.pending[0].Span.Start.Before(pos) {
+		p.comment(p.pending[0])
+		p.afterComment(p.pending[0])
+		p.pending = p.pending[1:]
+	}
+}
+
+// trailingComments prints the pending comments that come before pos, each
+// preceded by a space. If pos is not valid, it prints all of them.
+func (p *printer) trailingComments(pos ast.Position) {
+	for len(p.pending) > 0 && (!pos.IsValid() || p.pending[0].Span.Start.Before(pos)) {
+		p.buf.WriteString(" ")
+		p.comment(p.pending[0])
+		if isLineComment(p.pending[0]) {
+			p.afterComment(p.pending[0])
+		}
+		p.pending = p.pending[1:]
+	}
+}
+
+// lineComments prints the pending line comments that start on line, before
+// pos. They end up behind whatever was printed last, as they did in the source.
+func (p *printer) lineComments(line int, pos ast.Position) {
+	for len(p.pending) > 0 && isLineComment(p.pending[0]) && p.pending[0].Span.Start.Line == line && p.pending[0].Span.Start.Before(pos) {
+		p.buf.WriteString(" ")
+		p.comment(p.pending[0])
+		p.pending = p.pending[1:]
+	}
+}
+
+// afterComment separates a comment from whatever follows it on the same
+// line. A line comment runs until the end of the line, so the rest of the
+// statement continues on the next one.
+func (p *printer) afterComment(c *ast.Comment) {
+	if isLineComment(c) {
+		p.indent++
+		p.newline()
+		p.indent--
+	} else {
+		p.buf.WriteString(" ")
+	}
+}
+
+// skipComments drops the pending comments inside a span, since they are part
+// of the text of the node it belongs to
+func (p *printer) skipComments(span ast.Span) {
+	for len(p.pending) > 0 && span.Contains(p.pending[0].Span.Start) {
+		p.pending = p.pending[1:]
+	}
+}
+
+func isLineComment(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "//")
+}
+
+func (p *printer) expr(x ast.Expr) {
+	p.leadingComments(x.Location().Start)
+
+	switch x := x.(type) {
+	case *ast.Literal:
+		p.skipComments(x.Span)
+		p.buf.WriteString(x.Value)
+
+	case *ast.Variable:
+		p.buf.WriteString("$" + x.Name)
+
+	case *ast.Call:
+		p.buf.WriteString(x.Name + "(")
+		p.exprs(x.Args, ", ")
+		p.buf.WriteString(")")
+
+	case *ast.KeywordArg:
+		p.buf.WriteString("$" + x.Name + ":")
+		if x.Value != nil {
+			p.buf.WriteString(" ")
+			p.expr(x.Value)
+		}
+
+	case *ast.List:
+		if x.Comma {
+			p.exprs(x.Items, ", ")
+		} else {
+			p.exprs(x.Items, " ")
+		}
+
+	case *ast.Paren:
+		p.buf.WriteString("(")
+		if x.X != nil {
+			p.expr(x.X)
+		}
+		p.buf.WriteString(")")
+	}
+}
+
+func (p *printer) exprs(list []ast.Expr, sep string) {
+	for i, x := range list {
+		if i > 0 {
+			p.buf.WriteString(sep)
+		}
+		p.expr(x)
+	}
+}
+
+// selector puts exactly one space around combinators in a selector
+func selector(text string) string {
+	var rv strings.Builder
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' && i+1 < len(text) {
+				rv.WriteByte(c)
+				i++
+				c = text[i]
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '/' && i+1 < len(text) && text[i+1] == '*' {
+			// Copy comments as they are
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += i + 4
+			}
+			rv.WriteString(text[i:end])
+			i = end - 1
+			continue
+		} else if c == '/' && i+1 < len(text) && text[i+1] == '/' {
+			// A line comment runs until the line break that ends it
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += i + 1
+			}
+			rv.WriteString(text[i:end])
+			i = end - 1
+			continue
+		} else if c == '(' || c == '[' {
+			depth++
+		} else if c == ')' || c == ']' {
+			depth--
+		} else if depth == 0 && (c == '>' || c == '+' || c == '~') {
+			s := strings.TrimRight(rv.String(), " ")
+			rv.Reset()
+			rv.WriteString(s)
+			if s != "" && !strings.HasSuffix(s, "\n") {
+				rv.WriteByte(' ')
+			}
+			rv.WriteByte(c)
+			rv.WriteByte(' ')
+			for i+1 < len(text) && text[i+1] == ' ' {
+				i++
+			}
+			continue
+		}
+		rv.WriteByte(c)
+	}
+	return rv.String()
+}
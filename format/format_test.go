@@ -0,0 +1,140 @@
+package format_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss/format"
+)
+
+const unformatted = `/* Header
+   comment */
+@import   "a",'b' ;
+a,b>.c{color:red;margin : 0  (1px+2px) ; // trailing
+  .d   ~   .e
+{
+        background: url( img.png ) no-repeat,asset-url( "x.png" , $inline:true );
+
+
+      /*
+       * Block comment
+       */
+    }}
+f{}
+`
+
+const formatted = `/* Header
+   comment */
+@import "a", 'b';
+a,
+b > .c {
+	color: red;
+	margin: 0 (1px+2px); // trailing
+	.d ~ .e {
+		background: url( img.png ) no-repeat, asset-url("x.png", $inline: true);
+
+		/*
+		 * Block comment
+		 */
+	}
+}
+
+f {}
+`
+
+func Test_Source(t *testing.T) {
+	out, err := format.Source("test.scss", []byte(unformatted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != formatted {
+		t.Errorf("expected:\n%s\ngot:\n%s", formatted, out)
+	}
+}
+
+func Test_InlineComments(t *testing.T) {
+	// Comments stay where they are, even inside a statement
+	tests := []struct {
+		src, expected string
+	}{
+		{"a { color: /* c */ red; }", "a {\n\tcolor: /* c */ red;\n}\n"},
+		{"a { color: red /* c */ ; }", "a {\n\tcolor: red /* c */;\n}\n"},
+		{"a { color /* c */ : red; }", "a {\n\tcolor /* c */: red;\n}\n"},
+		{"a { margin: 0 /* c */ 1px, f( /* d */ x); }", "a {\n\tmargin: 0 /* c */ 1px, f(/* d */ x);\n}\n"},
+		{"a { margin: 0 // c\n  1px; }", "a {\n\tmargin: 0 // c\n\t\t1px;\n}\n"},
+		{"a { color: red; /* c */ }", "a {\n\tcolor: red; /* c */\n}\n"},
+		{"a, /* x */ b { c: d; }", "a,\n/* x */ b {\n\tc: d;\n}\n"},
+		{"a /* x */ { c: d; }", "a /* x */ {\n\tc: d;\n}\n"},
+		{"a /* x > y */  >  b { c: d; }", "a /* x > y */ > b {\n\tc: d;\n}\n"},
+		{"a\n// c\nb { x: y }", "a // c\n\tb {\n\tx: y;\n}\n"},
+		{"a // c > d\n  >  b { x: y }", "a // c > d\n\t> b {\n\tx: y;\n}\n"},
+		{"a // c\n, b { x: y }", "a, // c\nb {\n\tx: y;\n}\n"},
+		{"a, // c\n// d\nb { x: y }", "a, // c\n// d\n\tb {\n\tx: y;\n}\n"},
+		{"a [title='//'] { x: y }", "a [title='//'] {\n\tx: y;\n}\n"},
+		{"@import /* x */ 'a' /* y */;", "@import /* x */ 'a' /* y */;\n"},
+	}
+
+	for _, test := range tests {
+		once, err := format.Source("test.scss", []byte(test.src))
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if string(once) != test.expected {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", test.src, test.expected, once)
+		}
+		if twice, err := format.Source("test.scss", once); err != nil || string(twice) != string(once) {
+			t.Errorf("%q: formatting isn't idempotent:\n%s\n---\n%s", test.src, once, twice)
+		}
+	}
+}
+
+func Test_Idempotent(t *testing.T) {
+	files, err := filepath.Glob("../test_vectors/source/*.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, "")
+
+	for _, name := range files {
+		src := []byte(formatted)
+		if name != "" {
+			// Skip the vectors that aren't supposed to compile
+			errFile := filepath.Join("../test_vectors/expected", strings.TrimSuffix(filepath.Base(name), ".scss")+".err")
+			if _, err := os.Stat(errFile); err == nil {
+				continue
+			}
+			if src, err = ioutil.ReadFile(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		once, err := format.Source(name, src)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		twice, err := format.Source(name, once)
+		if err != nil {
+			t.Errorf("%s: formatted output doesn't parse: %v", name, err)
+			continue
+		}
+		if string(once) != string(twice) {
+			t.Errorf("%s: formatting isn't idempotent:\n%s\n---\n%s", name, once, twice)
+		}
+	}
+}
+
+func Test_SyntaxError(t *testing.T) {
+	src := []byte("a { color: red; \n")
+	out, err := format.Source("test.scss", src)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if string(out) != string(src) {
+		t.Errorf("expected the source to be returned unchanged, got %q", out)
+	}
+}
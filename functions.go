@@ -0,0 +1,225 @@
+package scss
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// A Function implements a SassScript function in Go. It receives one
+// argument for every parameter in its signature, in the same order, with
+// defaults filled in. A rest parameter receives a comma-separated List.
+// Errors are reported as Sass errors at the place the function was called.
+type Function func(args []Value) (Value, error)
+
+// A customFunction is a Function along with its parsed signature
+type customFunction struct {
+	name   string
+	params []parameter
+	rest   string
+	fn     Function
+}
+
+type parameter struct {
+	name string
+
+	// def is the default value, or nil if the parameter is required
+	def Value
+}
+
+// parseSignature parses a function signature such as
+// "asset-url($path, $inline: false)"
+func parseSignature(signature string, fn Function) (*customFunction, error) {
+	open := strings.IndexByte(signature, '(')
+	if open < 0 || closingParen(signature, open) != len(signature)-1 {
+		return nil, fmt.Errorf("invalid function signature '%s': expected name($param, ...)", signature)
+	}
+
+	rv := &customFunction{name: strings.TrimSpace(signature[:open]), fn: fn}
+	if rv.name == "" || strings.IndexFunc(rv.name, func(r rune) bool { return r < 0x80 && !isNameChar(byte(r)) }) >= 0 {
+		return nil, fmt.Errorf("invalid function signature '%s': bad function name", signature)
+	}
+
+	list := strings.TrimSpace(signature[open+1 : len(signature)-1])
+	if list == "" {
+		return rv, nil
+	}
+
+	for _, p := range splitTopLevel(list, ',') {
+		if rv.rest != "" {
+			return nil, fmt.Errorf("invalid function signature '%s': the rest parameter must come last", signature)
+		}
+
+		name, def := p, ""
+		if colon := strings.IndexByte(p, ':'); colon >= 0 {
+			name, def = strings.TrimSpace(p[:colon]), p[colon+1:]
+		}
+
+		if strings.HasSuffix(name, "...") && def == "" {
+			rv.rest = strings.TrimSuffix(name, "...")
+			name = rv.rest
+		}
+		if len(name) < 2 || name[0] != '$' {
+			return nil, fmt.Errorf("invalid function signature '%s': bad parameter '%s'", signature, p)
+		}
+		if rv.rest != "" {
+			continue
+		}
+
+		param := parameter{name: name}
+		if def != "" {
+			param.def = parseValue(def)
+		}
+		rv.params = append(rv.params, param)
+	}
+
+	return rv, nil
+}
+
+// call binds the arguments to the parameters, and calls the function
+func (f *customFunction) call(args []string) (Value, error) {
+	values := make([]Value, len(f.params))
+	var rest List
+	rest.Comma = true
+	named := false
+
+	for i, arg := range args {
+		name := ""
+		if len(arg) > 1 && arg[0] == '$' {
+			if colon := strings.IndexByte(arg, ':'); colon > 0 && strings.IndexFunc(arg[1:colon], func(r rune) bool { return r < 0x80 && !isNameChar(byte(r)) }) < 0 {
+				name, arg = arg[:colon], arg[colon+1:]
+			}
+		}
+
+		if name == "" {
+			if named {
+				return nil, fmt.Errorf("Positional arguments must come before keyword arguments.")
+			} else if i < len(f.params) {
+				values[i] = parseValue(arg)
+			} else if f.rest != "" {
+				rest.Items = append(rest.Items, parseValue(arg))
+			} else {
+				return nil, fmt.Errorf("Only %d arguments allowed, but %d were passed.", len(f.params), len(args))
+			}
+			continue
+		}
+
+		named = true
+		found := false
+		for j, p := range f.params {
+			if p.name == name {
+				if values[j] != nil {
+					return nil, fmt.Errorf("Argument %s was passed both by position and by name.", name)
+				}
+				values[j] = parseValue(arg)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No argument named %s.", name)
+		}
+	}
+
+	for i, p := range f.params {
+		if values[i] == nil {
+			if p.def == nil {
+				return nil, fmt.Errorf("Missing argument %s.", p.name)
+			}
+			values[i] = p.def
+		}
+	}
+	if f.rest != "" {
+		values = append(values, rest)
+	}
+
+	rv, err := f.fn(values)
+	if err == nil && rv == nil {
+		rv = Null{}
+	}
+	return rv, err
+}
+
+// applyFunctions replaces calls to custom functions in a property value by
+// their results. Calls are found among the tokens of the value, so text that
+// merely looks like a call, such as in a string or an unquoted url(), is left
+// alone. Arguments are evaluated before the function is called. The function
+// at returns the source location of a part of the value, so errors can be
+// reported at the call that caused them.
+func applyFunctions(value string, functions map[string]*customFunction, at func(start, end int) Span) (string, error) {
+	var tokens []*lexer.Token
+	l := lexer.New(value, nullState)
+	for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+		if tok.Type != lexer.ErrorToken {
+			tokens = append(tokens, tok)
+		}
+	}
+
+	var rv strings.Builder
+	written := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Type != FunctionToken {
+			continue
+		}
+		fn, ok := functions[strings.TrimSuffix(tok.Value, "(")]
+		if !ok {
+			continue
+		}
+
+		// Find the closing parenthesis, and the commas between the arguments
+		depth := 0
+		bounds := []int{tok.End.Offset}
+		end := -1
+		for j := i + 1; j < len(tokens) && end < 0; j++ {
+			t := tokens[j]
+			if t.Type == FunctionToken || (t.Type == DelimToken && (t.Value == "(" || t.Value == "[")) {
+				depth++
+			} else if t.Type == DelimToken && (t.Value == ")" || t.Value == "]") {
+				if depth == 0 {
+					end = t.Offset
+					i = j
+				}
+				depth--
+			} else if t.Type == DelimToken && t.Value == "," && depth == 0 {
+				bounds = append(bounds, t.Offset, t.End.Offset)
+			}
+		}
+		if end < 0 {
+			return "", compileErrorAt(ErrFunction, "Expected: ')'", nil, at(tok.Offset, len(value)))
+		}
+		bounds = append(bounds, end)
+
+		var args []string
+		if strings.TrimSpace(value[tok.End.Offset:end]) != "" {
+			for k := 0; k < len(bounds); k += 2 {
+				arg := value[bounds[k]:bounds[k+1]]
+				offset := bounds[k] + len(arg) - len(strings.TrimLeft(arg, " \t\n"))
+				argAt := func(start, end int) Span {
+					return at(offset+start, offset+end)
+				}
+
+				arg, err := applyFunctions(strings.TrimSpace(arg), functions, argAt)
+				if err != nil {
+					return "", err
+				}
+				args = append(args, arg)
+			}
+		}
+
+		result, err := fn.call(args)
+		if err != nil {
+			return "", compileErrorAt(ErrFunction, "Error in function "+fn.name+"()", err, at(tok.Offset, end+1))
+		}
+		rv.WriteString(value[written:tok.Offset])
+		rv.WriteString(result.CSS())
+		written = end + 1
+	}
+
+	rv.WriteString(value[written:])
+	return rv.String(), nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '-' || c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,177 @@
+package scss_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+)
+
+func assetURL(manifest map[string]string) scss.Function {
+	return func(args []scss.Value) (scss.Value, error) {
+		path, ok := args[0].(scss.String)
+		if !ok {
+			return nil, errors.New("$path: expected a string")
+		}
+		url, ok := manifest[path.Text]
+		if !ok {
+			return nil, errors.New("unknown asset '" + path.Text + "'")
+		}
+		if scss.IsTruthy(args[1]) {
+			url = "data:" + url
+		}
+		return scss.String{Text: "url(" + url + ")"}, nil
+	}
+}
+
+func Test_CustomFunctions(t *testing.T) {
+	c := scss.NewCompiler(scss.Options{
+		Filename: "test.scss",
+		Functions: map[string]scss.Function{
+			"asset-url($path, $inline: false)": assetURL(map[string]string{"logo.png": "/logo.1234.png"}),
+			"sum($numbers...)": func(args []scss.Value) (scss.Value, error) {
+				var rv scss.Number
+				for _, n := range args[0].(scss.List).Items {
+					rv.Value += n.(scss.Number).Value
+					rv.Unit = n.(scss.Number).Unit
+				}
+				return rv, nil
+			},
+		},
+	})
+
+	cases := []struct {
+		in, out string
+	}{
+		{`asset-url("logo.png")`, `url(/logo.1234.png) no-repeat`},
+		{`asset-url("logo.png", true)`, `url(data:/logo.1234.png) no-repeat`},
+		{`asset-url($inline: true, $path: "logo.png")`, `url(data:/logo.1234.png) no-repeat`},
+		{`sum(1px, 2px, sum(3px, 4px))`, `10px no-repeat`},
+		{`url(logo.png)`, `url(logo.png) no-repeat`},
+
+		// Text that only looks like a call is left alone
+		{`url(sum\(1px\).png)`, `url(sum\(1px\).png) no-repeat`},
+		{`url(/img/sum\(1\,2\).png)`, `url(/img/sum\(1\,2\).png) no-repeat`},
+		{`url("a\"sum(1px)")`, `url("a\"sum(1px)") no-repeat`},
+		{`icon\(sum(1px)`, `icon\(sum(1px) no-repeat`},
+		{`"sum(1px, 2px)"`, `"sum(1px, 2px)" no-repeat`},
+		{`url("sum(1px)") sum(1px, 2px)`, `url("sum(1px)") 3px no-repeat`},
+		{`my-sum(1px)`, `my-sum(1px) no-repeat`},
+	}
+
+	for _, c_ := range cases {
+		res, err := c.CompileString(".a {\n\tbackground: " + c_.in + " no-repeat;\n}\n")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c_.in, err)
+			continue
+		}
+		expected := ".a {\n\tbackground: " + c_.out + ";\n}\n"
+		if res.CSS != expected {
+			t.Errorf("%s: expected %q, got %q", c_.in, expected, res.CSS)
+		}
+	}
+}
+
+func Test_CustomFunctionErrors(t *testing.T) {
+	c := scss.NewCompiler(scss.Options{Filename: "test.scss"})
+	err := c.RegisterFunction("asset-url($path, $inline: false)", assetURL(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors are reported at the call that failed, which starts at column 14
+	cases := []struct {
+		in, message string
+		span        string
+	}{
+		{`asset-url("logo.png")`, "unknown asset 'logo.png'", "2:14-2:35"},
+		{`asset-url()`, "Missing argument $path.", "2:14-2:25"},
+		{`asset-url("a", true, 3)`, "Only 2 arguments allowed, but 3 were passed.", "2:14-2:37"},
+		{`asset-url($href: "a")`, "No argument named $href.", "2:14-2:35"},
+		{`url(x) no-repeat, asset-url( "a" )`, "unknown asset 'a'", "2:32-2:48"},
+		{`asset-url(asset-url("a"))`, "unknown asset 'a'", "2:24-2:38"},
+	}
+
+	for _, c_ := range cases {
+		_, err := c.CompileString(".a {\n\tbackground: " + c_.in + ";\n}\n")
+		diags := scss.Diagnose(err, "", "")
+		if len(diags) != 1 {
+			t.Errorf("%s: expected 1 error, got %v", c_.in, err)
+			continue
+		}
+		d := diags[0]
+		if d.Message != c_.message || d.Code != scss.ErrFunction {
+			t.Errorf("%s: expected %q, got %s %q", c_.in, c_.message, d.Code, d.Message)
+		}
+		if span := d.Span.Start.String() + "-" + d.Span.End.String(); d.Span.File != "test.scss" || span != c_.span {
+			t.Errorf("%s: expected the error at %s, got %s-%s", c_.in, c_.span, d.Span, d.Span.End)
+		}
+		if !strings.Contains(d.Snippet, "^^^") {
+			t.Errorf("%s: missing snippet in %q", c_.in, d.Snippet)
+		}
+	}
+}
+
+func Test_StringEscapes(t *testing.T) {
+	// Strings go into a function and come out unchanged
+	c := scss.NewCompiler(scss.Options{
+		OutputStyle: scss.Compressed,
+		Charset:     scss.CharsetNever,
+		Functions: map[string]scss.Function{
+			"echo($s)": func(args []scss.Value) (scss.Value, error) {
+				return args[0], nil
+			},
+		},
+	})
+
+	cases := []struct {
+		in, out string
+	}{
+		{`"plain"`, `"plain"`},
+		{`"a\\b"`, `"a\\b"`},
+		{`"a\"b"`, `"a\"b"`},
+		{`'it\'s'`, `"it's"`},
+		{`'say "hi"'`, `"say \"hi\""`},
+		{`"\41 BC"`, `"ABC"`},
+		{`"\e9t\e9"`, `"été"`},
+		{`"a\A b"`, `"a\a b"`},
+		{`echo(echo("a\\b"))`, `"a\\b"`},
+	}
+
+	for _, c_ := range cases {
+		in := c_.in
+		if !strings.HasPrefix(in, "echo(") {
+			in = "echo(" + in + ")"
+		}
+		res, err := c.CompileString(".a { content: " + in + "; }")
+		expected := ".a{content:" + c_.out + "}"
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c_.in, err)
+		} else if res.CSS != expected {
+			t.Errorf("%s: expected %s, got %s", c_.in, expected, res.CSS)
+		}
+	}
+
+	for _, text := range []string{"a\\b", "\"", "line\nbreak", "tab\t", "é😀", "\\41"} {
+		s := scss.String{Text: text, Quoted: true}
+		res, err := c.CompileString(".a { content: echo(" + s.CSS() + "); }")
+		if expected := ".a{content:" + s.CSS() + "}"; err != nil || res.CSS != expected {
+			t.Errorf("%q: expected %s, got %s %v", text, expected, res.CSS, err)
+		}
+	}
+}
+
+func Test_InvalidSignature(t *testing.T) {
+	noop := func(args []scss.Value) (scss.Value, error) { return nil, nil }
+	for _, sig := range []string{"asset-url", "asset-url(path)", "f($rest..., $a)", "(a)"} {
+		if err := scss.NewCompiler(scss.Options{}).RegisterFunction(sig, noop); err == nil {
+			t.Errorf("expected an error for signature %q", sig)
+		}
+	}
+
+	_, err := scss.NewCompiler(scss.Options{Functions: map[string]scss.Function{"bad": noop}}).CompileString("")
+	if err == nil {
+		t.Error("expected an invalid signature in the Options to be reported")
+	}
+}
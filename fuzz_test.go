@@ -0,0 +1,103 @@
+package scss
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// Inputs that made any of these fail are kept in testdata/fuzz, and are run
+// along with the other tests.
+
+// addSeeds adds the test vectors to the seed corpus
+func addSeeds(f *testing.F) {
+	files, err := filepath.Glob("test_vectors/source/*.scss")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+}
+
+// withTimeout fails the test if fn doesn't return in time, since an endless
+// loop would otherwise stall the fuzzer without telling which input did it
+func withTimeout(t *testing.T, src string, fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out on %q", src)
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		withTimeout(t, src, func() {
+			// The tokens should cover the entire source, in order
+			offset := 0
+			l := lexer.New(src, nullState)
+			for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+				if tok.Offset != offset || tok.End.Offset < tok.Offset {
+					t.Fatalf("%q: token %q runs from %d to %d, expected it to start at %d", src, tok.Value, tok.Offset, tok.End.Offset, offset)
+				}
+				if tok.Type != lexer.ErrorToken && tok.Value != src[tok.Offset:tok.End.Offset] {
+					t.Fatalf("%q: token %q doesn't match the source %q", src, tok.Value, src[tok.Offset:tok.End.Offset])
+				}
+				if tok.Type != lexer.ErrorToken && tok.Offset == tok.End.Offset {
+					t.Fatalf("%q: empty token at %d", src, tok.Offset)
+				}
+				offset = tok.End.Offset
+			}
+			if offset != len(src) {
+				t.Fatalf("%q: tokens stop at %d, expected %d", src, offset, len(src))
+			}
+		})
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		withTimeout(t, src, func() {
+			_, err := Parse(src)
+			Diagnose(err, "fuzz.scss", src)
+			ParseAST("fuzz.scss", src)
+		})
+	})
+}
+
+func FuzzCompile(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		if !utf8.ValidString(src) {
+			return
+		}
+		withTimeout(t, src, func() {
+			c := NewCompiler(Options{Charset: CharsetNever, SourceMap: SourceMapOptions{Enabled: true}})
+			res, err := c.CompileString(src)
+			if err != nil {
+				return
+			}
+
+			// The output should be valid CSS, which is valid SCSS as well
+			if _, err := Parse(res.CSS); err != nil {
+				t.Fatalf("%q compiles to\n%s\nwhich doesn't parse: %v", src, res.CSS, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package scss
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isPlainImport reports whether an @import argument refers to a plain CSS
+// import, which is passed through to the output as-is.
+func isPlainImport(arg string) bool {
+	if len(arg) < 2 || (arg[0] != '"' && arg[0] != '\'') || arg[len(arg)-1] != arg[0] {
+		// Not a single quoted string, so e.g. url(...) or a media query
+		return true
+	}
+	url := arg[1 : len(arg)-1]
+	return strings.HasSuffix(url, ".css") || strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "//")
+}
+
+// fileImporter looks for imports in a list of directories. If dirs is empty,
+// it looks in the directory of the importing file instead.
+type fileImporter struct {
+	dirs []string
+}
+
+func (f fileImporter) Import(url, prev string) (string, []byte, error) {
+	for _, candidate := range f.candidates(url, prev) {
+		src, err := ioutil.ReadFile(candidate)
+		if err == nil {
+			return candidate, src, nil
+		} else if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+
+	return "", nil, nil
+}
+
+// candidates lists the files an import can refer to, in order of preference
+func (f fileImporter) candidates(url, prev string) []string {
+	dirs := f.dirs
+	if len(dirs) == 0 {
+		dirs = []string{filepath.Dir(prev)}
+	}
+
+	var rv []string
+	for _, dir := range dirs {
+		for _, candidate := range importCandidates(filepath.Join(dir, filepath.FromSlash(url))) {
+			rv = append(rv, filepath.Clean(candidate))
+		}
+	}
+	return rv
+}
+
+// importCandidates lists the file names an import path can refer to, in order
+// of preference
+func importCandidates(name string) []string {
+	dir, base := filepath.Split(name)
+	if strings.HasSuffix(base, ".scss") {
+		return []string{name, filepath.Join(dir, "_"+base)}
+	}
+	return []string{
+		filepath.Join(dir, base+".scss"),
+		filepath.Join(dir, "_"+base+".scss"),
+		filepath.Join(name, "index.scss"),
+		filepath.Join(name, "_index.scss"),
+	}
+}
@@ -0,0 +1,162 @@
+package scss_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+)
+
+// mapImporter serves imports from memory. Its paths start with "mem:".
+type mapImporter map[string]string
+
+func (m mapImporter) Import(url, prev string) (string, []byte, error) {
+	if url == "broken" {
+		return "", nil, errors.New("server on fire")
+	}
+	src, ok := m[url]
+	if !ok {
+		return "", nil, nil
+	}
+	return "mem:" + url, []byte(src), nil
+}
+
+// writeFiles creates files in dir. Slashes in the names separate directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_Imports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"src/_partial.scss":     ".partial { a: b; }",
+		"src/full.scss":         ".full { a: b; }",
+		"src/dir/_index.scss":   ".index { a: b; }",
+		"src/sub/_nested.scss":  "@import 'sibling';",
+		"src/sub/sibling.scss":  ".sibling { a: b; }",
+		"src/_shadow.scss":      ".relative { a: b; }",
+		"lib/_shadow.scss":      ".load-path { a: b; }",
+		"lib/vendor.scss":       ".vendor { a: b; }",
+		"src/loop.scss":         "@import 'loop2';",
+		"src/_loop2.scss":       "@import 'loop';",
+		"src/_uses-memory.scss": "@import 'memory';",
+	})
+
+	c := scss.NewCompiler(scss.Options{
+		OutputStyle: scss.Compressed,
+		LoadPaths:   []string{filepath.Join(dir, "lib")},
+		Importers:   []scss.Importer{mapImporter{"memory": ".memory { a: b; }", "vendor": ".not-reached { a: b; }"}},
+	})
+	tests := []struct {
+		imports  string
+		expected string
+		loaded   []string
+	}{
+		{"'partial'", ".partial{a:b}", []string{"src/_partial.scss"}},
+		{"'_partial.scss'", ".partial{a:b}", []string{"src/_partial.scss"}},
+		{"'full', 'dir'", ".full{a:b}.index{a:b}", []string{"src/full.scss", "src/dir/_index.scss"}},
+		{"'sub/nested'", ".sibling{a:b}", []string{"src/sub/_nested.scss", "src/sub/sibling.scss"}},
+
+		// Files next to the importing file come first, then Importers,
+		// and then the load paths
+		{"'shadow'", ".relative{a:b}", []string{"src/_shadow.scss"}},
+		{"'uses-memory'", ".memory{a:b}", []string{"src/_uses-memory.scss", "mem:memory"}},
+		{"'vendor'", ".not-reached{a:b}", []string{"mem:vendor"}},
+
+		// Plain CSS imports are passed through
+		{"'x.css', url(y), 'http://z'", "@import 'x.css';@import url(y);@import 'http://z';", nil},
+	}
+
+	for _, test := range tests {
+		entry := filepath.Join(dir, "src", "entry.scss")
+		writeFiles(t, dir, map[string]string{"src/entry.scss": "@import " + test.imports + ";\n"})
+		res, err := c.CompileFile(entry)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.imports, err)
+			continue
+		}
+		if res.CSS != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.imports, test.expected, res.CSS)
+		}
+
+		expected := []string{entry}
+		for _, f := range test.loaded {
+			if !strings.HasPrefix(f, "mem:") {
+				f = filepath.Join(dir, filepath.FromSlash(f))
+			}
+			expected = append(expected, f)
+		}
+		if strings.Join(res.LoadedFiles, " ") != strings.Join(expected, " ") {
+			t.Errorf("%s: expected to load %v, got %v", test.imports, expected, res.LoadedFiles)
+		}
+	}
+
+	// Without a load path, the file in lib can't be found
+	errorTests := []struct {
+		name, src, expected string
+	}{
+		{"src/e1.scss", "@import 'vendor';", "1:1: Can't find stylesheet to import: 'vendor'"},
+		{"src/e2.scss", "@import 'broken';", "1:1: server on fire"},
+		{"src/e3.scss", "@import 'loop';", "1:1: This file is already being imported: '" + filepath.Join(dir, "src", "loop.scss") + "'"},
+	}
+	c = scss.NewCompiler(scss.Options{Importers: []scss.Importer{mapImporter{}}, OnError: scss.KeepTarget})
+	for _, test := range errorTests {
+		writeFiles(t, dir, map[string]string{test.name: test.src})
+		_, err := c.CompileFile(filepath.Join(dir, filepath.FromSlash(test.name)))
+		diags := scss.Diagnose(err, "", "")
+		if len(diags) != 1 || diags[0].Span.Start.String()+": "+diags[0].Message != test.expected {
+			t.Errorf("%s: expected error %q, got %v", test.src, test.expected, err)
+		}
+	}
+
+	// The files a missing import could refer to are listed, so that a watcher
+	// knows which ones to look out for
+	res, _ := c.CompileFile(filepath.Join(dir, "src", "e1.scss"))
+	var missing []string
+	for _, f := range []string{"vendor.scss", "_vendor.scss", "vendor/index.scss", "vendor/_index.scss"} {
+		missing = append(missing, filepath.Join(dir, "src", filepath.FromSlash(f)))
+	}
+	if strings.Join(res.MissingFiles, " ") != strings.Join(missing, " ") {
+		t.Errorf("expected missing files %v, got %v", missing, res.MissingFiles)
+	}
+}
+
+func Test_CompileReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"_a.scss": ".a { b: c; }"})
+
+	// Relative imports are resolved against the Filename option
+	c := scss.NewCompiler(scss.Options{Filename: filepath.Join(dir, "stdin.scss"), OutputStyle: scss.Compressed})
+	res, err := c.CompileReader(strings.NewReader("@import 'a';\n.d { e: f; }\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ".a{b:c}.d{e:f}"; res.CSS != expected {
+		t.Errorf("expected %q, got %q", expected, res.CSS)
+	}
+
+	if _, err := c.CompileFile(filepath.Join(dir, "missing.scss")); !os.IsNotExist(err) {
+		t.Errorf("expected a file-not-found error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package diff computes line-based differences between two texts, and renders
+// them in the unified format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpKind is the kind of an edit operation
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// An Op is a single line in an edit script
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Lines returns the shortest edit script that turns a into b, using Myers'
+// algorithm.
+func Lines(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	// Find the length of the shortest edit script, remembering the furthest
+	// reaching path on every diagonal for each step
+	d := 0
+found:
+	for ; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break found
+			}
+		}
+	}
+
+	// Walk back through the trace to recover the path
+	var rv []Op
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rv = append(rv, Op{Equal, a[x]})
+		}
+		if x == prevX {
+			y--
+			rv = append(rv, Op{Insert, b[y]})
+		} else {
+			x--
+			rv = append(rv, Op{Delete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rv = append(rv, Op{Equal, a[x]})
+	}
+
+	for i, j := 0, len(rv)-1; i < j; i, j = i+1, j-1 {
+		rv[i], rv[j] = rv[j], rv[i]
+	}
+	return rv
+}
+
+// Unified returns the differences between a and b in the unified format, with
+// three lines of context. It returns an empty string if they are equal.
+func Unified(nameA, nameB, a, b string) string {
+	ops := Lines(splitLines(a), splitLines(b))
+
+	changed := false
+	for _, op := range ops {
+		if op.Kind != Equal {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	const context = 3
+	var rv strings.Builder
+	fmt.Fprintf(&rv, "--- %s\n+++ %s\n", nameA, nameB)
+
+	for i := 0; i < len(ops); {
+		// Find the next change
+		for i < len(ops) && ops[i].Kind == Equal {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Extend the hunk until there are more than twice the context lines
+		// between changes
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += context
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = run
+		}
+
+		// Count the lines in both files before and inside the hunk
+		lineA, lineB := 1, 1
+		for _, op := range ops[:start] {
+			if op.Kind != Insert {
+				lineA++
+			}
+			if op.Kind != Delete {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[start:end] {
+			if op.Kind != Insert {
+				countA++
+			}
+			if op.Kind != Delete {
+				countB++
+			}
+		}
+		if countA == 0 {
+			lineA--
+		}
+		if countB == 0 {
+			lineB--
+		}
+
+		fmt.Fprintf(&rv, "@@ -%s +%s @@\n", hunkRange(lineA, countA), hunkRange(lineB, countB))
+		for _, op := range ops[start:end] {
+			if op.Kind == Equal {
+				rv.WriteString(" ")
+			} else if op.Kind == Delete {
+				rv.WriteString("-")
+			} else {
+				rv.WriteString("+")
+			}
+			rv.WriteString(op.Line)
+		}
+
+		i = end
+	}
+
+	return rv.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits text into lines, keeping the line endings. A missing
+// newline at the end is marked the same way diff(1) does.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	rv := strings.SplitAfter(text, "\n")
+	if rv[len(rv)-1] == "" {
+		rv = rv[:len(rv)-1]
+	} else {
+		rv[len(rv)-1] += "\n\\ No newline at end of file\n"
+	}
+	return rv
+}
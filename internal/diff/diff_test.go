@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Unified(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nk\nl\n"
+
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -7,5 +7,5 @@
+ g
+ h
+ i
+-j
+ k
++l
+`
+	if got := Unified("old", "new", a, b); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if got := Unified("old", "new", a, a); got != "" {
+		t.Errorf("expected no differences, got:\n%s", got)
+	}
+
+	got := Unified("old", "new", "", "x")
+	if !strings.HasSuffix(got, "@@ -0,0 +1 @@\n+x\n\\ No newline at end of file\n") {
+		t.Errorf("unexpected diff for a new file:\n%s", got)
+	}
+}
+
+func Test_Lines(t *testing.T) {
+	a := strings.Split("the quick brown fox jumps over the lazy dog", " ")
+	b := strings.Split("the quick red fox jumps over the dog again", " ")
+
+	var gotA, gotB []string
+	edits := 0
+	for _, op := range Lines(a, b) {
+		if op.Kind != Insert {
+			gotA = append(gotA, op.Line)
+		}
+		if op.Kind != Delete {
+			gotB = append(gotB, op.Line)
+		}
+		if op.Kind != Equal {
+			edits++
+		}
+	}
+
+	if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+		t.Errorf("edit script doesn't reproduce the input: %v / %v", gotA, gotB)
+	}
+	if edits != 4 {
+		t.Errorf("expected 4 edits, got %d", edits)
+	}
+}
@@ -0,0 +1,178 @@
+// Package hrx reads Human Readable Archives, the format the sass-spec test
+// suite is stored in. See https://github.com/google/hrx for the format.
+package hrx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An Entry is a file or directory in an archive
+type Entry struct {
+	// Path is relative to the root of the archive, and uses forward slashes.
+	// The paths of directories end in a slash.
+	Path string
+
+	Contents string
+
+	// Comment holds the comment in front of the entry, if there is one
+	Comment string
+}
+
+// IsDir reports whether the entry is a directory
+func (e Entry) IsDir() bool {
+	return strings.HasSuffix(e.Path, "/")
+}
+
+// An Archive is a list of entries, in the order they appear in the file
+type Archive struct {
+	Entries []Entry
+}
+
+// ReadFile reads and parses an archive
+func ReadFile(filename string) (*Archive, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filename, string(data))
+}
+
+// Parse parses an archive. The name is only used in error messages.
+func Parse(name, data string) (*Archive, error) {
+	rv := &Archive{}
+	if data == "" {
+		return rv, nil
+	}
+
+	boundary := ""
+	if data[0] == '<' {
+		n := 1
+		for n < len(data) && data[n] == '=' {
+			n++
+		}
+		if n > 1 && n < len(data) && data[n] == '>' {
+			boundary = data[:n+1]
+		}
+	}
+	if boundary == "" {
+		return nil, fmt.Errorf("%s:1: archive doesn't start with a boundary", name)
+	}
+
+	// Every entry is a header line, followed by the body up to the next line
+	// that starts with the boundary. The map records which paths are
+	// directories.
+	seen := make(map[string]bool)
+	comment, hasComment := "", false
+	line := 1
+	for rest := data; rest != ""; {
+		header, body := rest, ""
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			header, body = rest[:i], rest[i+1:]
+		}
+		headerLine := line
+		line++
+		if strings.HasPrefix(body, boundary) {
+			rest, body = body, ""
+		} else if end := strings.Index(body, "\n"+boundary); end >= 0 {
+			rest, body = body[end+1:], body[:end]
+			line += strings.Count(body, "\n") + 1
+		} else {
+			rest = ""
+		}
+
+		path := header[len(boundary):]
+		if path == "" {
+			if hasComment {
+				return nil, fmt.Errorf("%s:%d: two comments in a row", name, headerLine)
+			}
+			comment, hasComment = body, true
+			continue
+		} else if path[0] != ' ' {
+			return nil, fmt.Errorf("%s:%d: expected a space after the boundary", name, headerLine)
+		}
+		path = path[1:]
+
+		isDir := strings.HasSuffix(path, "/")
+		clean := strings.TrimSuffix(path, "/")
+		if err := checkPath(clean); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, headerLine, err)
+		} else if isDir && strings.Trim(body, "\n") != "" {
+			return nil, fmt.Errorf("%s:%d: directory %s has contents", name, headerLine, path)
+		} else if _, ok := seen[clean]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate path %s", name, headerLine, path)
+		}
+		seen[clean] = isDir
+
+		rv.Entries = append(rv.Entries, Entry{Path: path, Contents: body, Comment: comment})
+		comment, hasComment = "", false
+	}
+
+	// A file can't also be a directory
+	for _, e := range rv.Entries {
+		for dir := parentDir(e.Path); dir != ""; dir = parentDir(dir) {
+			if isDir, ok := seen[dir]; ok && !isDir {
+				return nil, fmt.Errorf("%s: %s is used as both a file and a directory", name, dir)
+			}
+		}
+	}
+
+	return rv, nil
+}
+
+// checkPath returns an error if path isn't a valid relative path
+func checkPath(path string) error {
+	for _, component := range strings.Split(path, "/") {
+		if component == "" || component == "." || component == ".." {
+			return fmt.Errorf("invalid path %q", path)
+		}
+		for _, r := range component {
+			if r < 0x20 || r == 0x7f || r == ':' || r == '\\' {
+				return fmt.Errorf("invalid character %q in path %q", r, path)
+			}
+		}
+	}
+	return nil
+}
+
+// parentDir returns the directory containing path, or "" at the root
+func parentDir(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// Get returns the contents of the file at path
+func (a *Archive) Get(path string) (string, bool) {
+	for _, e := range a.Entries {
+		if e.Path == path {
+			return e.Contents, true
+		}
+	}
+	return "", false
+}
+
+// Extract writes the contents of the archive to the directory dir
+func (a *Archive) Extract(dir string) error {
+	for _, e := range a.Entries {
+		name := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if e.IsDir() {
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name, []byte(e.Contents), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package hrx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	archive := `<===> input.scss
+a {
+  b: c;
+}
+
+<===> output.css
+a {
+  b: c;
+}
+<===>
+A comment about the directory
+<===> dir/
+<===> dir/empty
+<===> dir/<==>.txt
+<==> is not a boundary here
+<===>
+final comment
+`
+	a, err := Parse("test.hrx", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Path: "input.scss", Contents: "a {\n  b: c;\n}\n"},
+		{Path: "output.css", Contents: "a {\n  b: c;\n}"},
+		{Path: "dir/", Comment: "A comment about the directory"},
+		{Path: "dir/empty"},
+		{Path: "dir/<==>.txt", Contents: "<==> is not a boundary here"},
+	}
+	if !reflect.DeepEqual(a.Entries, expected) {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, a.Entries)
+	}
+
+	if s, ok := a.Get("output.css"); !ok || s != "a {\n  b: c;\n}" {
+		t.Errorf("Get(output.css) = %q, %v", s, ok)
+	}
+	if _, ok := a.Get("error"); ok {
+		t.Errorf("Get(error) found a file that doesn't exist")
+	}
+}
+
+func Test_ParseLastEntry(t *testing.T) {
+	a, err := Parse("test.hrx", "<=> a\nfoo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := a.Get("a"); s != "foo\n" {
+		t.Errorf("expected the last file to run up to the end, got %q", s)
+	}
+}
+
+func Test_ParseErrors(t *testing.T) {
+	tests := []struct {
+		archive, err string
+	}{
+		{"a\n<=> a\n", "test.hrx:1: archive doesn't start with a boundary"},
+		{"<=> a\n<=>b\n", "test.hrx:2: expected a space after the boundary"},
+		{"<=> a\n\n\n<=> ../b\n", "test.hrx:4: invalid path"},
+		{"<=> a\n<=> b:c\n", "test.hrx:2: invalid character ':'"},
+		{"<=> a\n<=> a\n", "test.hrx:2: duplicate path a"},
+		{"<=> a/\nfoo\n", "test.hrx:1: directory a/ has contents"},
+		{"<=>\none\n<=>\ntwo\n<=> a\n", "test.hrx:3: two comments in a row"},
+		{"<=> a\n<=> a/b\n", "test.hrx: a is used as both a file and a directory"},
+	}
+
+	for _, tc := range tests {
+		_, err := Parse("test.hrx", tc.archive)
+		if err == nil {
+			t.Errorf("%q: expected an error", tc.archive)
+		} else if !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("%q: expected error %q, got %q", tc.archive, tc.err, err)
+		}
+	}
+}
@@ -29,6 +29,7 @@ package lexer
 
 import (
 	"errors"
+	"io"
 	"strings"
 	"unicode/utf8"
 )
@@ -40,39 +41,124 @@ type TokenType int
 const (
 	EOFRune    rune      = -1
 	EmptyToken TokenType = 0
+
+	// ErrorToken reports an error found by a state function. Its value is
+	// the error message, and it covers the text analyzed since the last
+	// token. It's always the last token.
+	ErrorToken TokenType = -1
 )
 
+// Token is a single lexeme. Line and Column refer to the position of its first
+// rune; lines count from 1 and columns count from 0.
 type Token struct {
 	Type         TokenType
 	Value        string
 	Line, Column int
+
+	// Offset is the byte offset of the first rune in the source
+	Offset int
+
+	// End is the position just past the last rune
+	End Position
+
+	// File identifies the source the token was read from. It's copied from
+	// the lexer, and empty unless set there.
+	File string
 }
 
+// A Position is a location in the source. Offsets count bytes from 0, lines
+// count from 1 and columns count from 0.
+type Position struct {
+	Offset, Line, Column int
+}
+
+// ColumnUnit selects what columns are counted in
+type ColumnUnit int
+
+const (
+	// RuneColumns counts Unicode code points
+	RuneColumns ColumnUnit = iota
+
+	// UTF16Columns counts UTF-16 code units, as source maps and most
+	// editors do. Characters outside the Basic Multilingual Plane take up
+	// two columns.
+	UTF16Columns
+)
+
+// readSize is the initial size of the buffer of a lexer created by NewReader
+const readSize = 32 * 1024
+
 type L struct {
 	source          string
 	start, position int
 	line, column    int
+	startLine       int
+	startColumn     int
 	startState      StateFunc
 	Err             error
 	tokens          chan Token
 	ErrorHandler    func(e string)
 	rewind          runeStack
+
+	// File is copied onto every token, to tell apart tokens from different
+	// sources
+	File string
+
+	// Columns selects what the columns of tokens count
+	Columns ColumnUnit
+
+	// failed is set once an ErrorToken has been emitted
+	failed bool
+
+	// reader is where the rest of the source comes from, if the lexer was
+	// created by NewReader. Such a lexer keeps its source in buf rather than
+	// in source. Offsets are counted from the start of the input, but buf
+	// only holds the part from offset base on.
+	reader io.Reader
+	base   int
+	buf    []byte
+
+	// state is the next state function to run when NextToken needs more
+	// tokens, and queue holds the tokens it emitted that weren't returned yet
+	state StateFunc
+	queue []Token
+	head  int
+
+	// slab is preallocated space for the tokens NextToken returns
+	slab []Token
 }
 
 // New creates a returns a lexer ready to parse the given source code.
 func New(src string, start StateFunc) *L {
 	return &L{
-		source:     src,
-		startState: start,
-		start:      0,
-		position:   0,
-		line:       1,
-		column:     0,
-		rewind:     newRuneStack(),
+		source:      src,
+		startState:  start,
+		start:       0,
+		position:    0,
+		line:        1,
+		column:      0,
+		startLine:   1,
+		startColumn: 0,
+		rewind:      newRuneStack(),
+		state:       start,
 	}
 }
 
+// NewReader creates a lexer that reads its source from r as it goes. Only
+// the current token and a bit of lookahead are kept in memory. If reading
+// fails, the lexer stops as if it reached the end of the source, and the
+// error is stored in Err.
+func NewReader(r io.Reader, start StateFunc) *L {
+	rv := New("", start)
+	rv.reader = r
+	rv.buf = make([]byte, 0, readSize)
+	return rv
+}
+
 // Start begins executing the Lexer in an asynchronous manner (using a goroutine).
+//
+// Deprecated: the goroutine leaks if the consumer stops reading before the
+// end of the source. NextToken runs the lexer on demand if it isn't started.
 func (l *L) Start() {
 	// Take half the string length as a buffer size.
 	buffSize := len(l.source) / 2
@@ -83,6 +169,10 @@ func (l *L) Start() {
 	go l.run()
 }
 
+// StartSync runs the Lexer to the end before returning.
+//
+// Deprecated: this blocks forever if the source has more tokens than fit in
+// the channel. NextToken runs the lexer on demand if it isn't started.
 func (l *L) StartSync() {
 	// Take half the string length as a buffer size.
 	buffSize := len(l.source) / 2
@@ -95,25 +185,38 @@ func (l *L) StartSync() {
 
 // Current returns the value being being analyzed at this moment.
 func (l *L) Current() string {
+	if l.buf != nil {
+		return string(l.buf[l.start-l.base : l.position-l.base])
+	}
 	return l.source[l.start:l.position]
 }
 
 // Emit will receive a token type and push a new token with the current analyzed
-// value into the tokens channel.
+// value into the tokens channel, or onto the queue read by NextToken if the
+// lexer wasn't started.
 func (l *L) Emit(t TokenType) {
+	l.emitValue(t, l.Current())
+}
+
+func (l *L) emitValue(t TokenType, value string) {
+	if l.failed {
+		return
+	}
 	tok := Token{
 		Type:   t,
-		Value:  l.Current(),
-		Line:   l.line,
-		Column: l.column,
+		Value:  value,
+		Line:   l.startLine,
+		Column: l.startColumn,
+		Offset: l.start,
+		End:    Position{Offset: l.position, Line: l.line, Column: l.column},
+		File:   l.File,
 	}
-	if l.rewind.start != nil {
-		tok.Line = l.rewind.start.l
-		tok.Column = l.rewind.start.c
+	if l.tokens != nil {
+		l.tokens <- tok
+	} else {
+		l.queue = append(l.queue, tok)
 	}
-	l.tokens <- tok
-	l.start = l.position
-	l.rewind.clear()
+	l.Ignore()
 }
 
 // Ignore clears the rewind stack and then sets the current beginning position
@@ -122,6 +225,8 @@ func (l *L) Emit(t TokenType) {
 func (l *L) Ignore() {
 	l.rewind.clear()
 	l.start = l.position
+	l.startLine = l.line
+	l.startColumn = l.column
 }
 
 // Peek performs a Next operation immediately followed by a Rewind returning the
@@ -137,9 +242,10 @@ func (l *L) Peek() rune {
 // occur more than once per call to Next but you can never rewind past the
 // last point a token was emitted.
 func (l *L) Rewind() {
-	r, ln, cl := l.rewind.pop()
+	r, size, ln, cl := l.rewind.pop()
 	if r > EOFRune {
-		size := utf8.RuneLen(r)
+		// The size isn't always utf8.RuneLen(r), since invalid UTF-8 is
+		// read as utf8.RuneError one byte at a time
 		l.position -= size
 		if l.position < l.start {
 			l.position = l.start
@@ -156,18 +262,25 @@ func (l *L) Next() rune {
 		r rune
 		s int
 	)
-	str := l.source[l.position:]
-	if len(str) == 0 {
-		r, s = EOFRune, 0
+	if l.buf != nil {
+		for l.reader != nil && len(l.buf)-(l.position-l.base) < utf8.UTFMax {
+			l.fill()
+		}
+		r, s = utf8.DecodeRune(l.buf[l.position-l.base:])
 	} else {
-		r, s = utf8.DecodeRuneInString(str)
+		r, s = utf8.DecodeRuneInString(l.source[l.position:])
+	}
+	if s == 0 {
+		r = EOFRune
 	}
 	l.position += s
-	l.rewind.push(r, l.line, l.column)
+	l.rewind.push(r, s, l.line, l.column)
 	if r == '\n' {
 		l.line++
 		l.column = 0
-	} else {
+	} else if l.Columns == UTF16Columns && r >= 0x10000 {
+		l.column += 2
+	} else if r != EOFRune {
 		l.column++
 	}
 
@@ -186,23 +299,79 @@ func (l *L) Take(chars string) {
 }
 
 // NextToken returns the next token from the lexer and a value to denote whether
-// or not the token is finished.
+// or not the token is finished. If the lexer wasn't started, it runs state
+// functions until one of them emits a token, without using a goroutine.
 func (l *L) NextToken() (*Token, bool) {
-	if tok, ok := <-l.tokens; ok {
-		return &tok, false
-	} else {
+	if l.tokens != nil {
+		if tok, ok := <-l.tokens; ok {
+			return &tok, false
+		} else {
+			return nil, true
+		}
+	}
+
+	for l.head == len(l.queue) && l.state != nil && !l.failed {
+		l.queue = l.queue[:0]
+		l.head = 0
+		l.state = l.state(l)
+	}
+	if l.head == len(l.queue) {
 		return nil, true
 	}
+
+	// Allocate tokens in batches rather than one by one
+	if len(l.slab) == 0 {
+		l.slab = make([]Token, 64)
+	}
+	rv := &l.slab[0]
+	l.slab = l.slab[1:]
+	*rv = l.queue[l.head]
+	l.head++
+	return rv, false
+}
+
+// fill reads more of the source from the reader into the free space at the end
+// of buf. If there's little space left, the part before the start of the
+// current token is dropped, since it can't be rewound to. The buffer doubles
+// in size if that doesn't free up at least half of it, so a long token is
+// only copied a few times rather than on every read.
+func (l *L) fill() {
+	if cap(l.buf)-len(l.buf) < readSize/4 {
+		keep := l.buf[l.start-l.base:]
+		buf := l.buf[:0]
+		if len(keep) > cap(l.buf)/2 {
+			buf = make([]byte, 0, 2*cap(l.buf))
+		}
+		l.buf = append(buf, keep...)
+		l.base = l.start
+	}
+
+	n, err := 0, error(nil)
+	for n == 0 && err == nil {
+		n, err = l.reader.Read(l.buf[len(l.buf):cap(l.buf)])
+	}
+	l.buf = l.buf[:len(l.buf)+n]
+
+	if err != nil {
+		l.reader = nil
+		if err != io.EOF {
+			l.Err = err
+		}
+	}
 }
 
 // Partial yyLexer implementation
 
+// Error reports an error at the text analyzed since the last token. If there
+// is an ErrorHandler, it is called with the message. Otherwise, the lexer
+// emits an ErrorToken and stops once the current state function returns.
 func (l *L) Error(e string) {
+	l.Err = errors.New(e)
 	if l.ErrorHandler != nil {
-		l.Err = errors.New(e)
 		l.ErrorHandler(e)
-	} else {
-		panic(e)
+	} else if !l.failed {
+		l.emitValue(ErrorToken, e)
+		l.failed = true
 	}
 }
 
@@ -210,7 +379,7 @@ func (l *L) Error(e string) {
 
 func (l *L) run() {
 	state := l.startState
-	for state != nil {
+	for state != nil && !l.failed {
 		state = state(l)
 	}
 	close(l.tokens)
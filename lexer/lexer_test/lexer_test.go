@@ -2,7 +2,9 @@ package lexer_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/thijzert/go-scss/lexer"
 )
@@ -105,7 +107,7 @@ func Test_LexingNumbers(t *testing.T) {
 	}
 
 	if tok != nil {
-		t.Error("Expected a nil token, but got %v", *tok)
+		t.Errorf("Expected a nil token, but got %v", *tok)
 		return
 	}
 }
@@ -202,3 +204,159 @@ func Test_LexerError(t *testing.T) {
 		return
 	}
 }
+
+func Test_PullWithoutStart(t *testing.T) {
+	l := lexer.New("123.hello  675.world", NumberState)
+
+	var values []string
+	for {
+		tok, done := l.NextToken()
+		if done {
+			break
+		}
+		values = append(values, tok.Value)
+	}
+
+	if fmt.Sprint(values) != "[123 . hello 675 . world]" {
+		t.Errorf("Unexpected tokens %q", values)
+	}
+}
+
+func Test_PullStopEarly(t *testing.T) {
+	// Stopping halfway shouldn't leave anything running in the background
+	l := lexer.New("123.hello  675.world", NumberState)
+	tok, _ := l.NextToken()
+	if tok.Value != "123" {
+		t.Errorf("Expected %q but got %q", "123", tok.Value)
+	}
+}
+
+// WordState emits every run of characters between whitespace
+func WordState(l *lexer.L) lexer.StateFunc {
+	r := l.Next()
+	for r == ' ' || r == '\n' {
+		l.Ignore()
+		r = l.Next()
+	}
+	if r == lexer.EOFRune {
+		return nil
+	}
+	for r != ' ' && r != '\n' && r != lexer.EOFRune {
+		r = l.Next()
+	}
+	l.Rewind()
+	l.Emit(IdentToken)
+	return WordState
+}
+
+func Test_Positions(t *testing.T) {
+	cases := []struct {
+		reader   bool
+		columns  lexer.ColumnUnit
+		expected string
+	}{
+		{false, lexer.RuneColumns, "[ab 1:0 0 1:2 2] [😀x 1:3 3 1:5 8] [cd 2:0 9 2:2 11]"},
+		{false, lexer.UTF16Columns, "[ab 1:0 0 1:2 2] [😀x 1:3 3 1:6 8] [cd 2:0 9 2:2 11]"},
+		{true, lexer.RuneColumns, "[ab 1:0 0 1:2 2] [😀x 1:3 3 1:5 8] [cd 2:0 9 2:2 11]"},
+		{true, lexer.UTF16Columns, "[ab 1:0 0 1:2 2] [😀x 1:3 3 1:6 8] [cd 2:0 9 2:2 11]"},
+	}
+
+	for _, c := range cases {
+		l := lexer.New("ab 😀x\ncd", WordState)
+		if c.reader {
+			// Read one byte at a time, to split runes and tokens across reads
+			l = lexer.NewReader(iotest.OneByteReader(strings.NewReader("ab 😀x\ncd")), WordState)
+		}
+		l.File = "test.scss"
+		l.Columns = c.columns
+
+		got := ""
+		for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+			if tok.File != "test.scss" {
+				t.Errorf("Expected file %q but got %q", "test.scss", tok.File)
+			}
+			got += fmt.Sprintf(" [%s %d:%d %d %d:%d %d]", tok.Value, tok.Line, tok.Column, tok.Offset, tok.End.Line, tok.End.Column, tok.End.Offset)
+		}
+		if got[1:] != c.expected {
+			t.Errorf("Expected %s but got %s", c.expected, got[1:])
+		}
+	}
+}
+
+func Test_ReaderRewind(t *testing.T) {
+	l := lexer.NewReader(iotest.OneByteReader(strings.NewReader("aü")), nil)
+	l.Next()
+	l.Next()
+	if l.Current() != "aü" {
+		t.Errorf("Expected %q but got %q", "aü", l.Current())
+	}
+	l.Rewind()
+	if r := l.Peek(); r != 'ü' {
+		t.Errorf("Expected %q but got %q", 'ü', r)
+	}
+	if l.Current() != "a" {
+		t.Errorf("Expected %q but got %q", "a", l.Current())
+	}
+}
+
+func Test_ReaderLongTokens(t *testing.T) {
+	// Tokens much longer than a single read, mixed with short ones, so the
+	// buffer both grows and moves the current token to the front
+	var words []string
+	for i := 0; i < 20; i++ {
+		words = append(words, strings.Repeat(string(rune('a'+i)), 1<<uint(i)), "x")
+	}
+	src := strings.Join(words, " ")
+
+	var got []string
+	l := lexer.NewReader(strings.NewReader(src), WordState)
+	for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+		got = append(got, tok.Value)
+	}
+	if len(got) != len(words) {
+		t.Fatalf("Expected %d tokens but got %d", len(words), len(got))
+	}
+	for i := range words {
+		if got[i] != words[i] {
+			t.Errorf("Token %d: expected %d bytes of %q but got %d bytes starting with %q", i, len(words[i]), words[i][0], len(got[i]), got[i][:1])
+		}
+	}
+}
+
+func Test_ReaderError(t *testing.T) {
+	// The second read fails
+	l := lexer.NewReader(iotest.TimeoutReader(strings.NewReader("ab cd")), WordState)
+
+	got := ""
+	for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+		got += " " + tok.Value
+	}
+	if got != " ab cd" {
+		t.Errorf("Expected %q but got %q", " ab cd", got)
+	}
+	if l.Err != iotest.ErrTimeout {
+		t.Errorf("Expected error %v, but got %v", iotest.ErrTimeout, l.Err)
+	}
+}
+
+func Test_ErrorToken(t *testing.T) {
+	l := lexer.New("1.x!2", NumberState)
+
+	var got []string
+	for tok, done := l.NextToken(); !done; tok, done = l.NextToken() {
+		got = append(got, fmt.Sprintf("%d %q %d:%d-%d:%d", tok.Type, tok.Value, tok.Line, tok.Column, tok.End.Line, tok.End.Column))
+	}
+
+	expected := []string{
+		`0 "1" 1:0-1:1`,
+		`1 "." 1:1-1:2`,
+		`2 "x" 1:2-1:3`,
+		`-1 "unexpected token '!'" 1:3-1:4`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if l.Err == nil || l.Err.Error() != "unexpected token '!'" {
+		t.Errorf("Expected an error on the lexer, but got %v", l.Err)
+	}
+}
@@ -2,38 +2,34 @@ package lexer
 
 type runeNode struct {
 	r    rune
+	size int
 	l, c int
-	next *runeNode
 }
 
+// runeStack is backed by a slice, so it doesn't need to allocate once it has
+// grown to the length of the longest token
 type runeStack struct {
-	start *runeNode
+	nodes []runeNode
 }
 
 func newRuneStack() runeStack {
 	return runeStack{}
 }
 
-func (s *runeStack) push(r rune, l, c int) {
-	node := &runeNode{r: r, l: l, c: c}
-	if s.start == nil {
-		s.start = node
-	} else {
-		node.next = s.start
-		s.start = node
-	}
+func (s *runeStack) push(r rune, size, l, c int) {
+	s.nodes = append(s.nodes, runeNode{r: r, size: size, l: l, c: c})
 }
 
-func (s *runeStack) pop() (rune, int, int) {
-	if s.start == nil {
-		return EOFRune, 0, 0
+func (s *runeStack) pop() (rune, int, int, int) {
+	if len(s.nodes) == 0 {
+		return EOFRune, 0, 0, 0
 	} else {
-		n := s.start
-		s.start = n.next
-		return n.r, n.l, n.c
+		n := s.nodes[len(s.nodes)-1]
+		s.nodes = s.nodes[:len(s.nodes)-1]
+		return n.r, n.size, n.l, n.c
 	}
 }
 
 func (s *runeStack) clear() {
-	s.start = nil
+	s.nodes = s.nodes[:0]
 }
@@ -0,0 +1,160 @@
+package scss
+
+import (
+	"fmt"
+	"io"
+)
+
+// Options control the behaviour of a Compiler. The zero value is usable, and
+// gives the same output as Compile.
+type Options struct {
+	// Filename is the name of the entry file. It is used to resolve relative
+	// imports and in error messages. CompileFile sets this automatically.
+	Filename string
+
+	// LoadPaths lists the directories that are searched for imports, after
+	// the directory of the importing file and any Importers.
+	LoadPaths []string
+
+	// Importers can load imports from places other than the file system.
+	// They are tried in order, after looking relative to the importing file.
+	Importers []Importer
+
+	OutputStyle OutputStyle
+	SourceMap   SourceMapOptions
+
+	// Precision is the number of digits after the decimal point to which
+	// numbers are rounded. If zero, this defaults to 10.
+	Precision int
+
+	// Logger receives all warnings and debug messages as they happen. They
+	// are also returned as part of the Result.
+	Logger Logger
+
+	// Functions maps function signatures, such as
+	// "asset-url($path, $inline: false)", onto their implementations in Go.
+	// Calls to these functions in property values are replaced by their
+	// return value. See also Compiler.RegisterFunction.
+	Functions map[string]Function
+
+	Charset Charset
+
+	// OnError determines what output is returned if compilation fails
+	OnError OnError
+}
+
+// OutputStyle determines how the CSS output is laid out
+type OutputStyle int
+
+const (
+	// Nested indents rules to reflect the nesting in the source
+	Nested OutputStyle = iota
+
+	// Expanded puts every rule on the top level
+	Expanded
+
+	// Compressed removes as much whitespace as possible
+	Compressed
+)
+
+func (o OutputStyle) String() string {
+	if o == Nested {
+		return "nested"
+	} else if o == Expanded {
+		return "expanded"
+	} else if o == Compressed {
+		return "compressed"
+	} else {
+		return fmt.Sprintf("OutputStyle(%d)", int(o))
+	}
+}
+
+// Set parses an OutputStyle from its name, so it can be used as a command-line flag
+func (o *OutputStyle) Set(s string) error {
+	for _, v := range []OutputStyle{Nested, Expanded, Compressed} {
+		if s == v.String() {
+			*o = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output style '%s'; expected 'nested', 'expanded' or 'compressed'", s)
+}
+
+// Charset determines when the output starts with a @charset declaration (or,
+// in compressed mode, a byte-order mark)
+type Charset int
+
+const (
+	// CharsetAuto adds a @charset only if the output contains non-ASCII text.
+	// If that isn't clear within the first 64 KiB of output, it adds one
+	// whenever the stylesheet could produce non-ASCII text.
+	CharsetAuto Charset = iota
+	CharsetAlways
+	CharsetNever
+)
+
+func (c Charset) String() string {
+	if c == CharsetAuto {
+		return "auto"
+	} else if c == CharsetAlways {
+		return "always"
+	} else if c == CharsetNever {
+		return "never"
+	} else {
+		return fmt.Sprintf("Charset(%d)", int(c))
+	}
+}
+
+// Set parses a Charset from its name, so it can be used as a command-line flag
+func (c *Charset) Set(s string) error {
+	for _, v := range []Charset{CharsetAuto, CharsetAlways, CharsetNever} {
+		if s == v.String() {
+			*c = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown charset policy '%s'; expected 'auto', 'always' or 'never'", s)
+}
+
+type SourceMapOptions struct {
+	// Enabled causes a source map to be generated
+	Enabled bool
+
+	// EmbedSources includes the contents of all source files in the map
+	EmbedSources bool
+
+	// Inline appends the source map to the CSS as a data: URL. Otherwise,
+	// it's up to the caller to save it and link to it; see SourceMappingURL.
+	Inline bool
+}
+
+// A Logger receives warnings and debug messages from the compiler
+type Logger interface {
+	Warn(d Diagnostic)
+	Debug(d Diagnostic)
+}
+
+// NewLogger returns a Logger that writes all messages to w
+func NewLogger(w io.Writer) Logger {
+	return writerLogger{w}
+}
+
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l writerLogger) Warn(d Diagnostic) {
+	fmt.Fprintln(l.w, d.String())
+}
+
+func (l writerLogger) Debug(d Diagnostic) {
+	fmt.Fprintf(l.w, "%s DEBUG: %s\n", d.Span, d.Message)
+}
+
+// An Importer locates and loads imported stylesheets.
+type Importer interface {
+	// Import finds url, which is imported from the file prev. It returns
+	// the canonical path and the contents of the imported file. If the
+	// importer can't find the file, it returns an empty path and no error.
+	Import(url, prev string) (path string, src []byte, err error)
+}
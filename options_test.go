@@ -0,0 +1,153 @@
+package scss_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+)
+
+func Test_OutputStyle(t *testing.T) {
+	src := "@import 'x.css';\n.a { b: c; .d { e: f; } }\n"
+	tests := []struct {
+		style    scss.OutputStyle
+		expected string
+	}{
+		{scss.Nested, "@import 'x.css';\n.a {\n\tb: c;\n}\n\t.a .d {\n\t\te: f;\n\t}\n"},
+		{scss.Expanded, "@import 'x.css';\n.a {\n\tb: c;\n}\n.a .d {\n\te: f;\n}\n"},
+		{scss.Compressed, "@import 'x.css';.a{b:c}.a .d{e:f}"},
+	}
+
+	for _, test := range tests {
+		res, err := scss.NewCompiler(scss.Options{OutputStyle: test.style}).CompileString(src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.style, err)
+		} else if res.CSS != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.style, test.expected, res.CSS)
+		}
+	}
+}
+
+func Test_Charset(t *testing.T) {
+	tests := []struct {
+		charset  scss.Charset
+		style    scss.OutputStyle
+		src      string
+		expected string
+	}{
+		{scss.CharsetAuto, scss.Expanded, ".a { b: c; }", ".a {\n\tb: c;\n}\n"},
+		{scss.CharsetAuto, scss.Expanded, ".a { b: 'é'; }", "@charset \"UTF-8\";\n.a {\n\tb: 'é';\n}\n"},
+		{scss.CharsetAuto, scss.Expanded, ".é { b: c; }", "@charset \"UTF-8\";\n.é {\n\tb: c;\n}\n"},
+		{scss.CharsetAuto, scss.Compressed, ".a { b: 'é'; }", "\uFEFF.a{b:'é'}"},
+		{scss.CharsetAlways, scss.Expanded, ".a { b: c; }", "@charset \"UTF-8\";\n.a {\n\tb: c;\n}\n"},
+		{scss.CharsetAlways, scss.Compressed, ".a { b: c; }", "\uFEFF.a{b:c}"},
+		{scss.CharsetNever, scss.Expanded, ".a { b: 'é'; }", ".a {\n\tb: 'é';\n}\n"},
+		{scss.CharsetNever, scss.Compressed, ".a { b: 'é'; }", ".a{b:'é'}"},
+
+		// Only text that ends up in the output counts
+		{scss.CharsetAuto, scss.Expanded, "/* é */\n.é { }\n.a { b: c; }", ".a {\n\tb: c;\n}\n"},
+	}
+
+	for _, test := range tests {
+		res, err := scss.NewCompiler(scss.Options{Charset: test.charset, OutputStyle: test.style}).CompileString(test.src)
+		if err != nil {
+			t.Errorf("%s, %s, %q: unexpected error: %v", test.charset, test.style, test.src, err)
+		} else if res.CSS != test.expected {
+			t.Errorf("%s, %s, %q: expected %q, got %q", test.charset, test.style, test.src, test.expected, res.CSS)
+		}
+	}
+
+	// The output is held back until the first character that isn't ASCII,
+	// and then the charset goes in front of it. The mappings should be the
+	// same as when it's there from the start.
+	src := ".a { b: c; }\n.d { e: f; }\n.é { g: h; }\n"
+	for _, style := range []scss.OutputStyle{scss.Expanded, scss.Compressed} {
+		var mappings [2]string
+		for i, charset := range []scss.Charset{scss.CharsetAuto, scss.CharsetAlways} {
+			c := scss.NewCompiler(scss.Options{Charset: charset, OutputStyle: style, SourceMap: scss.SourceMapOptions{Enabled: true}})
+			res, err := c.CompileString(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mappings[i] = res.SourceMap.Mappings
+		}
+		if mappings[0] != mappings[1] {
+			t.Errorf("%s: expected mappings %q, got %q", style, mappings[1], mappings[0])
+		}
+	}
+
+	// Only the first 64 KiB are held back. If the rules could still produce
+	// something that isn't ASCII after that, the charset is declared anyway.
+	big := strings.Repeat(".a { b: c; }\n", 10000)
+	large := []struct {
+		src     string
+		charset bool
+	}{
+		{"/* é */\n" + big, false},
+		{big + "// é\n", false},
+		{big + ".é { b: c; }\n", true},
+		{".é { b: c; }\n" + big, true},
+		{big + ".é { }\n", true},
+	}
+	for i, test := range large {
+		css, err := scss.Compile(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(css, "@charset") != test.charset {
+			t.Errorf("large stylesheet %d: expected a charset declaration to be %v, got %q", i, test.charset, css[:30])
+		}
+	}
+}
+
+func Test_Precision(t *testing.T) {
+	tests := []struct {
+		precision int
+		value     string
+		expected  string
+	}{
+		{0, "1.123456789012345px", "1.123456789px"},
+		{0, "1.5 10.25% .5em", "1.5 10.25% .5em"},
+		{3, "1.123456789px 10.0001%", "1.123px 10%"},
+		{3, "-0.0001 +.12345 .0001", "-0 +.123 0"},
+		{3, "1.23456e3", "1.235e3"},
+
+		// Only numbers are rounded
+		{3, "url(a/1.123456.png)", "url(a/1.123456.png)"},
+		{3, "'1.123456' \"2.123456\"", "'1.123456' \"2.123456\""},
+		{3, "#a1.123456 foo.123456", "#a1.123 foo.123"},
+	}
+
+	for _, test := range tests {
+		c := scss.NewCompiler(scss.Options{Precision: test.precision, OutputStyle: scss.Compressed})
+		res, err := c.CompileString(".a { b: " + test.value + "; }")
+		expected := ".a{b:" + test.expected + "}"
+		if err != nil {
+			t.Errorf("%d, %s: unexpected error: %v", test.precision, test.value, err)
+		} else if res.CSS != expected {
+			t.Errorf("%d, %s: expected %q, got %q", test.precision, test.value, expected, res.CSS)
+		}
+	}
+}
+
+func Test_OptionNames(t *testing.T) {
+	var style scss.OutputStyle
+	for _, s := range []string{"nested", "expanded", "compressed"} {
+		if err := style.Set(s); err != nil || style.String() != s {
+			t.Errorf("%s: got %v, %v", s, style, err)
+		}
+	}
+	if err := style.Set("compact"); err == nil {
+		t.Errorf("expected an error for an unknown output style")
+	}
+
+	var charset scss.Charset
+	for _, s := range []string{"auto", "always", "never"} {
+		if err := charset.Set(s); err != nil || charset.String() != s {
+			t.Errorf("%s: got %v, %v", s, charset, err)
+		}
+	}
+	if err := charset.Set("utf-8"); err == nil {
+		t.Errorf("expected an error for an unknown charset policy")
+	}
+}
@@ -1,84 +1,175 @@
 package scss
 
 import (
+	"strings"
+
 	"github.com/thijzert/go-scss/lexer"
 )
 
 type Property struct {
 	Key, Value string
+	Span       Span
+
+	// value holds the tokens that make up the value
+	value []*lexer.Token
+
+	// colon is the ':' after the key, and end is the ';' after the value,
+	// or nil if the declaration ends at a '}'
+	colon, end *lexer.Token
 }
 type Scope struct {
 	Properties []Property
 	Subrules   []Rule
+
+	// open and close are the curly braces around the block
+	open, close *lexer.Token
 }
 type Rule struct {
 	Selector Selector
 	Scope    Scope
+
+	// AtRule is set if this is an @-directive rather than a style rule
+	AtRule *AtRule
+
+	// Span covers the selector list, or the entire @-directive
+	Span Span
+
+	// selector holds the tokens that make up the selector list
+	selector []*lexer.Token
+}
+
+// An AtRule is an @-directive, such as @import or @warn
+type AtRule struct {
+	// Name is the name of the directive, without the '@'
+	Name string
+
+	// Args holds the comma-separated arguments, as they appear in the source
+	Args []string
+
+	// params holds the tokens that make up the arguments
+	params []*lexer.Token
+
+	// end is the ';' after the arguments, if there is one
+	end *lexer.Token
 }
 type IR struct {
 	Rules []Rule
 }
 
+// Parse parses a stylesheet. Syntax errors do not stop the parser; instead, it
+// skips to the end of the offending declaration or block and carries on. All
+// errors are returned together as an ErrorList, along with the rules that
+// could be parsed.
 func Parse(src string) (rv IR, err error) {
+	return parseFile("", src)
+}
+
+// parseFile parses a stylesheet, recording the file name in all spans
+func parseFile(filename, src string) (rv IR, err error) {
 	l := lexer.New(src, nullState)
-	l.Start()
+	l.File = filename
 	tok := NewTokenRing(l)
 	rv, err = parseIR(tok)
 	return
 }
 
 func parseIR(tok *TokenRing) (rv IR, err error) {
-	tok.Mark()
 	rv.Rules = make([]Rule, 0)
 
+	var errs ErrorList
+
 	peek := tok.Ignore(WhitespaceToken)
 	tok.Rewind()
 
 	var rule Rule
 	for peek != nil {
-		if peek.Type == OperatorToken && (peek.Value == "@" || peek.Value == "$") {
-			// TODO: handle @import, $macro, @mixin...
-			if peek.Value == "@" {
-				err = parseError("@-directives are not implemented", nil, peek)
-				tok.Backtrack()
-				return
-			} else if peek.Value == "$" {
-				err = parseError("Macros are not implemented", nil, peek)
-				tok.Backtrack()
-				return
+		err = nil
+		if isAtKeyword(peek) {
+			rule, err = parseAtRule(tok)
+			if err == nil {
+				rv.Rules = append(rv.Rules, rule)
+			} else {
+				errs = append(errs, err)
+				skipStatement(tok)
+			}
+		} else if peek.Type == VariableToken {
+			// TODO: handle $macro, @mixin...
+			errs = append(errs, unsupportedError("Macros are not implemented", peek))
+			skipStatement(tok)
+		} else if peek.Type == DelimToken && peek.Value == "}" {
+			// A stray '}' can't close anything at the top level
+			errs = append(errs, parseError("Unexpected '}'", nil, peek))
+			tok.Next()
+		} else {
+			rule, err = parseRule(tok, &errs)
+			if err == nil {
+				rv.Rules = append(rv.Rules, rule)
+			} else {
+				errs = append(errs, parseError("Error parsing rule", err, peek))
+				skipStatement(tok)
 			}
 		}
 
-		rule, err = parseRule(tok)
-
-		if err != nil {
-			err = parseError("Error parsing rule", err, peek)
-			tok.Backtrack()
-			return
-		}
-
-		rv.Rules = append(rv.Rules, rule)
-
 		peek = tok.Ignore(WhitespaceToken)
 		if peek != nil {
 			tok.Rewind()
 		}
 	}
 
-	tok.Unmark()
+	tok.Balanced()
+
+	// Errors from the lexer come first, since they usually explain the rest
+	errs = append(tok.Errors(), errs...)
+	err = errs.Err()
 	return
 }
 
-func parseRule(tok *TokenRing) (rv Rule, err error) {
+// skipStatement advances past the end of the current declaration or block, so
+// parsing can resume after a syntax error. It stops in front of a '}' that
+// would close the enclosing scope.
+func skipStatement(tok *TokenRing) {
+	depth := 0
+	for {
+		peek := tok.Next()
+		if peek == nil {
+			return
+		} else if peek.Type != DelimToken {
+			continue
+		}
+
+		if peek.Value == "{" {
+			depth++
+		} else if peek.Value == "}" {
+			if depth == 0 {
+				tok.Rewind()
+				return
+			}
+			depth--
+			if depth == 0 {
+				return
+			}
+		} else if peek.Value == ";" && depth == 0 {
+			return
+		}
+	}
+}
+
+func parseRule(tok *TokenRing, errs *ErrorList) (rv Rule, err error) {
 	tok.Mark()
+	start := tok.index
+	first := tok.Ignore(WhitespaceToken)
+	tok.Rewind()
+
 	rv.Selector, err = parseSelector(tok)
 	if err != nil {
 		err = parseError("Error parsing selector list", err, tok.Peek())
 		tok.Backtrack()
 		return
 	}
+	rv.Span = joinSpans(tokenSpan(first), tokenSpan(tok.LastSignificant(WhitespaceToken)))
+	rv.selector = tok.since(start)
 
-	rv.Scope, err = parseScope(tok)
+	rv.Scope, err = parseScope(tok, errs)
 	if err != nil {
 		err = parseError("Error parsing scope", err, tok.Peek())
 		tok.Backtrack()
@@ -88,31 +179,44 @@ func parseRule(tok *TokenRing) (rv Rule, err error) {
 	return
 }
 
-func parseScope(tok *TokenRing) (rv Scope, err error) {
+// parseScope parses a block of declarations and nested rules. Errors inside the
+// block are added to errs, and the offending item is skipped.
+func parseScope(tok *TokenRing, errs *ErrorList) (rv Scope, err error) {
 	tok.Mark()
 
 	peek := tok.Next()
-	if peek == nil || peek.Type != OperatorToken || peek.Value != "{" {
+	if peek == nil || peek.Type != DelimToken || peek.Value != "{" {
 		err = parseError("Expected: '{'", nil, peek)
 		tok.Backtrack()
 		return
 	}
-	peek = tok.Next()
+	rv.open = peek
+	peek = tok.Ignore(WhitespaceToken)
+	if peek != nil {
+		tok.Rewind()
+	}
 
 	var rule Rule
 	var prop Property
-	for peek != nil && (peek.Type != OperatorToken || peek.Value != "}") {
-		prop, err = parseProperty(tok)
-		if err == nil {
+	for peek != nil && (peek.Type != DelimToken || peek.Value != "}") {
+		if isAtKeyword(peek) {
+			rule, err = parseAtRule(tok)
+			if err == nil {
+				rv.Subrules = append(rv.Subrules, rule)
+			} else {
+				*errs = append(*errs, err)
+				skipStatement(tok)
+			}
+		} else if prop, err = parseProperty(tok); err == nil {
 			rv.Properties = append(rv.Properties, prop)
 		} else {
-			rule, err = parseRule(tok)
-			if err != nil {
-				err = parseError("Error parsing scope", err, peek)
-				tok.Backtrack()
-				return
+			rule, err = parseRule(tok, errs)
+			if err == nil {
+				rv.Subrules = append(rv.Subrules, rule)
+			} else {
+				*errs = append(*errs, parseError("Error parsing scope", err, peek))
+				skipStatement(tok)
 			}
-			rv.Subrules = append(rv.Subrules, rule)
 		}
 		peek = tok.Ignore(WhitespaceToken)
 		if peek != nil {
@@ -120,9 +224,86 @@ func parseScope(tok *TokenRing) (rv Scope, err error) {
 		}
 	}
 
+	err = nil
 	peek = tok.Next()
-	if peek == nil || peek.Type != OperatorToken || peek.Value != "}" {
-		err = parseError("Expected: '}'", nil, peek)
+	if peek == nil || peek.Type != DelimToken || peek.Value != "}" {
+		// Unterminated block; keep whatever we've found so far
+		*errs = append(*errs, parseError("Expected: '}'", nil, peek))
+	} else {
+		rv.close = peek
+	}
+
+	tok.Unmark()
+	return
+}
+
+func isAtKeyword(tok *lexer.Token) bool {
+	return tok.Type == AtKeywordToken
+}
+
+// parseAtRule parses an @-directive that doesn't have a block, up to and
+// including the closing ';'
+func parseAtRule(tok *TokenRing) (rv Rule, err error) {
+	tok.Mark()
+
+	peek := tok.Next()
+	name := peek.Value[1:]
+	if name != "import" && name != "warn" && name != "debug" {
+		err = unsupportedError("@"+name+" is not implemented", peek)
+		tok.Backtrack()
+		return
+	}
+	at := &AtRule{Name: name}
+	rv.AtRule = at
+	rv.Span = tokenSpan(peek)
+
+	arg := ""
+	depth := 0
+	for {
+		peek = tok.Next()
+		if peek == nil {
+			break
+		} else if peek.Type != DelimToken || (peek.Value != ";" && peek.Value != "}" && peek.Value != "{") {
+			at.params = append(at.params, peek)
+		}
+
+		if peek.Type == WhitespaceToken {
+			if arg != "" {
+				arg += " "
+			}
+			continue
+		} else if peek.Type == FunctionToken {
+			depth++
+		} else if peek.Type == DelimToken {
+			if peek.Value == ";" {
+				at.end = peek
+				break
+			} else if peek.Value == "}" {
+				tok.Rewind()
+				break
+			} else if peek.Value == "{" {
+				err = unsupportedError("@"+name+" can't have a block", peek)
+				tok.Backtrack()
+				return
+			} else if peek.Value == "," && depth == 0 {
+				at.Args = append(at.Args, strings.TrimSpace(arg))
+				arg = ""
+				continue
+			} else if peek.Value == "(" {
+				depth++
+			} else if peek.Value == ")" {
+				depth--
+			}
+		}
+		arg += peek.Value
+		rv.Span = joinSpans(rv.Span, tokenSpan(peek))
+	}
+
+	if arg = strings.TrimSpace(arg); arg != "" {
+		at.Args = append(at.Args, arg)
+	}
+	if len(at.Args) == 0 {
+		err = parseError("Expected: argument to @"+name, nil, peek)
 		tok.Backtrack()
 		return
 	}
@@ -140,13 +321,14 @@ func parseProperty(tok *TokenRing) (rv Property, err error) {
 		tok.Backtrack()
 		return
 	}
-	if peek.Type != SymbolToken {
+	if peek.Type != IdentToken && peek.Type != VariableToken {
 		err = parseError("expected symbol", nil, peek)
 		tok.Backtrack()
 		return
 	}
 
 	rv.Key = peek.Value
+	rv.Span = tokenSpan(peek)
 
 	peek = tok.Ignore(WhitespaceToken)
 	if peek == nil {
@@ -154,11 +336,12 @@ func parseProperty(tok *TokenRing) (rv Property, err error) {
 		tok.Backtrack()
 		return
 	}
-	if peek.Type != OperatorToken || peek.Value != ":" {
+	if peek.Type != DelimToken || peek.Value != ":" {
 		err = parseError("expected ':'", nil, peek)
 		tok.Backtrack()
 		return
 	}
+	rv.colon = peek
 
 	peek = tok.Next()
 	if peek == nil {
@@ -173,14 +356,19 @@ func parseProperty(tok *TokenRing) (rv Property, err error) {
 			if rv.Value != "" {
 				rv.Value = rv.Value + " "
 			}
-		} else if peek.Type == OperatorToken && (peek.Value == ";" || peek.Value == "}") {
+			rv.value = append(rv.value, peek)
+		} else if peek.Type == DelimToken && (peek.Value == ";" || peek.Value == "}") {
 			if peek.Value == "}" {
 				tok.Rewind()
+			} else {
+				rv.end = peek
 			}
 			tok.Unmark()
 			return
 		} else {
 			rv.Value = rv.Value + peek.Value
+			rv.value = append(rv.value, peek)
+			rv.Span = joinSpans(rv.Span, tokenSpan(peek))
 		}
 		peek = tok.Next()
 	}
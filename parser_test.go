@@ -0,0 +1,105 @@
+package scss
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// summary lists the declarations in a parsed stylesheet, with nested rules
+// in braces
+func summary(rules []Rule) string {
+	var rv []string
+	for _, r := range rules {
+		if r.AtRule != nil {
+			rv = append(rv, "@"+r.AtRule.Name)
+			continue
+		}
+		var props []string
+		for _, p := range r.Scope.Properties {
+			props = append(props, p.Key+":"+p.Value)
+		}
+		if len(r.Scope.Subrules) > 0 {
+			props = append(props, summary(r.Scope.Subrules))
+		}
+		rv = append(rv, "{"+strings.Join(props, " ")+"}")
+	}
+	return strings.Join(rv, " ")
+}
+
+func Test_ErrorRecovery(t *testing.T) {
+	tests := []struct {
+		src    string
+		rules  string
+		errors string
+	}{
+		// Every error in the file is reported
+		{
+			".a {\n  b c;\n  d: e;\n}\n.f { g: h; }\n.i { j k }\n",
+			"{d:e} {g:h} {}",
+			"2:6 Expected: '{'; 6:10 Expected: '{'",
+		},
+		// Parsing resumes after the ';' that ends a bad statement
+		{
+			"@foo bar;\n$x: 1;\n.a { b: c; }\n",
+			"{b:c}",
+			"1:1 @foo is not implemented; 2:1 Macros are not implemented",
+		},
+		{
+			".a { @media x; b: c; }\n",
+			"{b:c}",
+			"1:6 @media is not implemented",
+		},
+		{
+			".a { .b { c d; e: f; } g: h; }\n",
+			"{g:h {e:f}}",
+			"1:14 Expected: '{'",
+		},
+		// A bad nested block is skipped as a whole
+		{
+			".a { > > { c: d; } g: h; }\n.i { j: k; }\n",
+			"{g:h} {j:k}",
+			"1:8 unexpected operator '>'",
+		},
+		// An unbalanced '}' is reported, and the rest is parsed as usual
+		{
+			".a { b: c; }\n}\n.d { e: f; }\n",
+			"{b:c} {e:f}",
+			"2:1 Unexpected '}'",
+		},
+		{
+			".a { b: c; } } }\n.d { e: f; .g { h: i; } }\n",
+			"{b:c} {e:f {h:i}}",
+			"1:14 Unexpected '}'; 1:16 Unexpected '}'",
+		},
+	}
+
+	for _, test := range tests {
+		ir, err := Parse(test.src)
+		if got := summary(ir.Rules); got != test.rules {
+			t.Errorf("%q: expected rules %s, got %s", test.src, test.rules, got)
+		}
+
+		var got []string
+		for _, d := range Diagnose(err, "", test.src) {
+			got = append(got, fmt.Sprintf("%s %s", d.Span.Start, d.Message))
+		}
+		if strings.Join(got, "; ") != test.errors {
+			t.Errorf("%q: expected errors %q, got %q", test.src, test.errors, strings.Join(got, "; "))
+		}
+	}
+}
+
+func Test_ErrorList(t *testing.T) {
+	_, err := Parse(".a { b c; }\n.d { e f; }\n.g { h i; }\n")
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 3 {
+		t.Fatalf("expected a list of 3 errors, got %#v", err)
+	}
+	if expected := "Error parsing scope (and 2 more errors)"; list.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, list.Error())
+	}
+	if ErrorList(nil).Err() != nil {
+		t.Errorf("expected an empty list to be no error")
+	}
+}
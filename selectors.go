@@ -2,6 +2,9 @@ package scss
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/thijzert/go-scss/lexer"
 )
 
 type selectorNodeType int
@@ -15,6 +18,7 @@ const (
 	stCompoundDescendant
 	stCompoundDirectDescendant
 	stCompoundNextSibling
+	stCompoundSibling
 	stStar
 	stID
 	stTag
@@ -41,6 +45,8 @@ func (t selectorNodeType) String() string {
 		return "CompoundDirectDescendant"
 	} else if t == stCompoundNextSibling {
 		return "CompoundNextSibling"
+	} else if t == stCompoundSibling {
+		return "CompoundSibling"
 	} else if t == stID {
 		return "ID"
 	} else if t == stTag {
@@ -54,7 +60,7 @@ func (t selectorNodeType) String() string {
 	} else if t == stAttribute {
 		return "Attribute"
 	} else {
-		return fmt.Sprintf("Unknown type %d")
+		return fmt.Sprintf("Unknown type %d", int(t))
 	}
 }
 
@@ -68,9 +74,33 @@ type lefter interface {
 	Left() Selector
 }
 
-func parseSelector(tok *TokenRing) (rv Selector, err error) {
-	rv, _, err = realParseSelector(tok, &sAmpersand{false})
-	return
+// parseSelector parses a comma-separated list of selectors
+func parseSelector(tok *TokenRing) (Selector, error) {
+	var terms []Selector
+	var comma *lexer.Token
+	for {
+		sel, _, err := realParseSelector(tok, &sAmpersand{false})
+		if err != nil {
+			return nil, err
+		}
+		if comma != nil && sel.Type() == stImplicitAmp {
+			return nil, parseError("Unexpected end of selector after ','", nil, comma)
+		}
+		terms = append(terms, sel)
+
+		tok.Mark()
+		comma = tok.Ignore(WhitespaceToken)
+		if comma == nil || comma.Type != DelimToken || comma.Value != "," {
+			tok.Backtrack()
+			break
+		}
+		tok.Unmark()
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &sEither{terms}, nil
 }
 
 func realParseSelector(tok *TokenRing, left Selector) (rv Selector, explicitAmp bool, err error) {
@@ -91,7 +121,7 @@ func realParseSelector(tok *TokenRing, left Selector) (rv Selector, explicitAmp
 		err = parseError("Unexpected EOF", nil, nil)
 		tok.Backtrack()
 		return
-	} else if peek.Type == OperatorToken {
+	} else if peek.Type == DelimToken {
 		if peek.Value == ">" {
 			committed = true
 			tok.Next()
@@ -100,15 +130,20 @@ func realParseSelector(tok *TokenRing, left Selector) (rv Selector, explicitAmp
 			committed = true
 			tok.Next()
 			compType = stCompoundNextSibling
+		} else if peek.Value == "~" {
+			committed = true
+			tok.Next()
+			compType = stCompoundSibling
 		} else if peek.Value == "," {
 			if left.Type() == stImplicitAmp {
 				err = parseError("unexpected ','", nil, peek)
 				tok.Backtrack()
 				return
 			}
-			committed = true
-			tok.Next()
-			compType = stCompoundEither
+			// The comma ends this selector; parseSelector parses the rest
+			// of the list
+			tok.Backtrack()
+			return left, false, nil
 		}
 	}
 
@@ -120,6 +155,7 @@ func realParseSelector(tok *TokenRing, left Selector) (rv Selector, explicitAmp
 			tok.Backtrack()
 			return
 		} else {
+			tok.Unmark()
 			return left, explicitAmp, nil
 		}
 	}
@@ -136,32 +172,11 @@ func realParseSelector(tok *TokenRing, left Selector) (rv Selector, explicitAmp
 	}
 	err = nil
 
-	if compType != stCompoundEither {
-		if rr, ok := right.(*sEither); ok {
-			rrv := &sEither{make([]Selector, len(rr.Terms))}
-			for i, t := range rr.Terms {
-				rrv.Terms[i] = &sCompound{compType, left.Clone(), t}
-			}
-			rv = rrv
-		} else if left.Type() == stImplicitAmp && explicitAmp {
-			// No need for an implied amp node; we have one right here.
-			rv = right
-		} else {
-			rv = &sCompound{compType, left, right}
-		}
+	if left.Type() == stImplicitAmp && explicitAmp {
+		// No need for an implied amp node; we have one right here.
+		rv = right
 	} else {
-		rrv := &sEither{}
-		if rr, ok := right.(*sEither); ok {
-			// [.a, [.b, .c]] -> [.a, .b, .c]
-			rrv.Terms = make([]Selector, len(rr.Terms)+1)
-			rrv.Terms[0] = left
-			copy(rrv.Terms[1:], rr.Terms)
-		} else {
-			rrv.Terms = make([]Selector, 2)
-			rrv.Terms[0] = left
-			rrv.Terms[1] = right
-		}
-		rv = rrv
+		rv = &sCompound{compType, left, right}
 	}
 
 	if err == nil {
@@ -176,68 +191,62 @@ func parseSimpleSelector(tok *TokenRing) (rv Selector, err error) {
 	tok.Mark()
 	peek := tok.Ignore(WhitespaceToken)
 
-	if peek.Type == SymbolToken {
+	if peek == nil {
+		err = parseError("Unexpected EOF", nil, nil)
+	} else if peek.Type == IdentToken || peek.Type == PlaceholderToken || peek.Type == PercentageToken {
 		// TODO: Check against list of allowed tag names
 		// FIXME: Does such a list exist?
 		rv = &sTag{peek.Value}
-		tok.Unmark()
-	} else if peek.Type == OperatorToken {
+	} else if peek.Type == HashToken {
+		rv = &sID{peek.Value[1:]}
+	} else if peek.Type == DelimToken {
 		if peek.Value == "." {
 			// Class!
 			peek = tok.Next()
-			if peek == nil || peek.Type != SymbolToken {
+			if peek == nil || peek.Type != IdentToken {
 				err = parseError("Expected symbol", nil, peek)
 			} else {
 				rv = &sClass{peek.Value}
 			}
-		} else if peek.Value == "#" {
-			// ID
-			peek = tok.Next()
-			if peek == nil || peek.Type != SymbolToken {
-				err = parseError("Expected symbol", nil, peek)
-			} else {
-				rv = &sID{peek.Value}
-			}
 		} else if peek.Value == ":" {
 			// Either a function class or a CSS2.1 pseudoclass
 			peek = tok.Next()
-			if peek == nil || peek.Type != SymbolToken {
+			if peek != nil && peek.Type == FunctionToken {
+				// TODO: "function class"
+				err = unsupportedError("Function classes (e.g. \":"+peek.Value+"...)\" are not implemented", peek)
+			} else if peek == nil || peek.Type != IdentToken {
 				err = parseError("Expected symbol", nil, peek)
 			} else {
-				pp := tok.Peek()
-				if pp != nil && pp.Type == SymbolToken && pp.Value == "(" {
-					// TODO: "function class"
-					err = parseError("Function classes (e.g. \":"+peek.Value+"(...)\" are not implemented", nil, peek)
-				}
 				rv = &sPseudoclass{peek.Value}
 			}
 		} else if peek.Value == "[" {
 			// Attribute selector
-			peek = tok.Next()
-			if peek == nil || peek.Type != SymbolToken {
+			peek = tok.Ignore(WhitespaceToken)
+			if peek == nil || peek.Type != IdentToken {
 				err = parseError("[ Expected symbol", nil, peek)
 			} else {
 				rrv := &sAttribute{peek.Value, "", ""}
 				peek = tok.Ignore(WhitespaceToken)
-				if peek.Type != OperatorToken {
-					err = parseError("[ Expected operator", nil, peek)
-				} else {
-					for peek.Type == OperatorToken {
-						rrv.Operator += peek.Value
-						peek = tok.Next()
+				for peek != nil && peek.Type == DelimToken && peek.Value != "]" {
+					rrv.Operator += peek.Value
+					peek = tok.Next()
+				}
+				if rrv.Operator != "" {
+					if peek != nil && peek.Type == WhitespaceToken {
+						peek = tok.Ignore(WhitespaceToken)
 					}
-					tok.Rewind()
-					peek = tok.Ignore(WhitespaceToken)
-					if peek == nil || (peek.Type != SymbolToken && peek.Type != StringToken) {
-						err = parseError("[ Expected: string or symbol; got '"+peek.Value+"'", nil, peek)
+					if peek == nil || (peek.Type != IdentToken && peek.Type != StringToken) {
+						err = parseError("[ Expected: string or symbol", nil, peek)
 					} else {
 						rrv.Value = peek.Value
 						peek = tok.Ignore(WhitespaceToken)
-						if peek == nil || peek.Type != OperatorToken || peek.Value != "]" {
-							err = parseError("[ Expected: ']'", nil, peek)
-						} else {
-							rv = rrv
-						}
+					}
+				}
+				if err == nil {
+					if peek == nil || peek.Type != DelimToken || peek.Value != "]" {
+						err = parseError("[ Expected: ']'", nil, peek)
+					} else {
+						rv = rrv
 					}
 				}
 			}
@@ -300,7 +309,7 @@ func (s *sID) Type() selectorNodeType {
 	return stID
 }
 func (s *sID) Evaluate() string {
-	return s.ID
+	return "#" + s.ID
 }
 func (s *sID) Clone() Selector {
 	return &sID{s.ID}
@@ -373,17 +382,26 @@ func (s *sCompound) Type() selectorNodeType {
 	return s.CompoundType
 }
 func (s *sCompound) Evaluate() string {
+	var b strings.Builder
+	writeSelector(&b, s)
+	return b.String()
+}
+
+// separator returns the text that goes between the two halves
+func (s *sCompound) separator() string {
 	if s.CompoundType == stCompoundDirectDescendant {
-		return s.A.Evaluate() + ">" + s.B.Evaluate()
+		return ">"
 	} else if s.CompoundType == stCompoundDescendant {
-		return s.A.Evaluate() + " " + s.B.Evaluate()
+		return " "
 	} else if s.CompoundType == stCompoundNextSibling {
-		return s.A.Evaluate() + "+" + s.B.Evaluate()
+		return "+"
+	} else if s.CompoundType == stCompoundSibling {
+		return "~"
 	} else if s.CompoundType == stCompoundBoth {
-		return s.A.Evaluate() + s.B.Evaluate()
+		return ""
 	} else {
 		// FIXME: Detect this error in an earlier stage, and pass it through appropriate channels
-		return s.A.Evaluate() + "?" + s.B.Evaluate()
+		return "?"
 	}
 }
 func (s *sCompound) Clone() Selector {
@@ -401,14 +419,9 @@ func (s *sEither) Type() selectorNodeType {
 	return stCompoundEither
 }
 func (s *sEither) Evaluate() string {
-	rv := ""
-	for i, ss := range s.Terms {
-		if i > 0 {
-			rv += ","
-		}
-		rv += ss.Evaluate()
-	}
-	return rv
+	var b strings.Builder
+	writeSelector(&b, s)
+	return b.String()
 }
 func (s *sEither) Clone() Selector {
 	rv := &sEither{make([]Selector, len(s.Terms))}
@@ -418,16 +431,35 @@ func (s *sEither) Clone() Selector {
 	return rv
 }
 
+// writeSelector writes the text of a selector to b. Unlike Evaluate, it
+// doesn't build a string for every part of a compound selector.
+func writeSelector(b *strings.Builder, s Selector) {
+	if cs, ok := s.(*sCompound); ok {
+		writeSelector(b, cs.A)
+		b.WriteString(cs.separator())
+		writeSelector(b, cs.B)
+	} else if es, ok := s.(*sEither); ok {
+		for i, t := range es.Terms {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			writeSelector(b, t)
+		}
+	} else {
+		b.WriteString(s.Evaluate())
+	}
+}
+
 // Compose two selectors into one
 func composeSelectors(top, bottom Selector) (Selector, error) {
 	if bottom.Type() == stExplicitAmp {
 		if top == nil {
-			return bottom, compileError("Empty selector: composing <nil> and &", nil)
+			return bottom, selectorError("Empty selector: composing <nil> and &", nil)
 		}
 		return top.Clone(), nil
 	} else if top != nil && top.Type() == stExplicitAmp {
 		if bottom == nil {
-			return top, compileError("Empty selector: composing <nil> and &", nil)
+			return top, selectorError("Empty selector: composing <nil> and &", nil)
 		}
 		return bottom.Clone(), nil
 	} else if tcmp, ok := top.(*sEither); ok {
@@ -471,6 +503,22 @@ func composeSelectors(top, bottom Selector) (Selector, error) {
 	return applyAmpersand(top, bottom)
 }
 
+// hasExplicitAmp reports whether a selector refers to its parent with '&'
+func hasExplicitAmp(s Selector) bool {
+	if s.Type() == stExplicitAmp {
+		return true
+	} else if cmp, ok := s.(*sCompound); ok {
+		return hasExplicitAmp(cmp.A) || hasExplicitAmp(cmp.B)
+	} else if either, ok := s.(*sEither); ok {
+		for _, t := range either.Terms {
+			if hasExplicitAmp(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func applyAmpersand(amp, into Selector) (Selector, error) {
 	icmp, icmpOK := into.(*sCompound)
 
@@ -478,10 +526,12 @@ func applyAmpersand(amp, into Selector) (Selector, error) {
 		// This is a top-level selector.
 		// Remove implicit ampersand nodes from the selector
 
-		if icmpOK && into.Type() == stCompoundDescendant {
+		if hasExplicitAmp(into) {
+			return nil, selectorError("Top-level selectors may not contain the parent selector \"&\"", nil)
+		} else if icmpOK && into.Type() == stCompoundDescendant {
 			return icmp.B.Clone(), nil
 		} else {
-			return nil, compileError("Top-level selectors should be of the 'implicit descendant' type", nil)
+			return nil, selectorError("Top-level selectors should be of the 'implicit descendant' type", nil)
 		}
 	}
 
@@ -494,10 +544,10 @@ func applyAmpersand(amp, into Selector) (Selector, error) {
 		cb, eb := applyAmpersand(amp, icmp.B)
 
 		if ea != nil {
-			return nil, compileError(fmt.Sprintf("Can't apply ampersand to type \"%s\" somehow", icmp.A.Type()), ea)
+			return nil, selectorError(fmt.Sprintf("Can't apply ampersand to type \"%s\" somehow", icmp.A.Type()), ea)
 		}
 		if eb != nil {
-			return nil, compileError(fmt.Sprintf("Can't apply ampersand to type \"%s\" somehow", icmp.B.Type()), eb)
+			return nil, selectorError(fmt.Sprintf("Can't apply ampersand to type \"%s\" somehow", icmp.B.Type()), eb)
 		}
 
 		return &sCompound{icmp.Type(), ca, cb}, nil
@@ -0,0 +1,110 @@
+package scss
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// A SourceMap relates the generated CSS to the source files it came from. It
+// follows revision 3 of the source map format, and encodes to JSON as such.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file,omitempty"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+// RelativeTo rewrites the source paths to be relative to dir, which should be
+// the directory the source map is saved in.
+func (m *SourceMap) RelativeTo(dir string) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	for i, src := range m.Sources {
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(absDir, abs); err == nil {
+			m.Sources[i] = filepath.ToSlash(rel)
+		}
+	}
+}
+
+// SourceMappingURL returns the comment that links a stylesheet to its source map
+func SourceMappingURL(url string) string {
+	return "/*# sourceMappingURL=" + url + " */\n"
+}
+
+// inlineSourceMap returns the comment that embeds a source map in the stylesheet
+func inlineSourceMap(m *SourceMap) (string, error) {
+	j, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return SourceMappingURL("data:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(j)), nil
+}
+
+// A mapping relates a position in the output to a position in a source file.
+// All lines and columns count from 0.
+type mapping struct {
+	genLine, genColumn int
+	source             int
+	srcLine, srcColumn int
+
+	// srcOffset is the byte offset in the source file
+	srcOffset int
+}
+
+// encodeMappings encodes mappings into the format used by source maps. The
+// mappings should be ordered by their position in the output.
+func encodeMappings(mappings []mapping) string {
+	var rv strings.Builder
+	line := 0
+	prevColumn, prevSource, prevSrcLine, prevSrcColumn := 0, 0, 0, 0
+
+	for i, m := range mappings {
+		if m.genLine > line {
+			rv.WriteString(strings.Repeat(";", m.genLine-line))
+			line = m.genLine
+			prevColumn = 0
+		} else if i > 0 {
+			rv.WriteByte(',')
+		}
+
+		writeVLQ(&rv, m.genColumn-prevColumn)
+		writeVLQ(&rv, m.source-prevSource)
+		writeVLQ(&rv, m.srcLine-prevSrcLine)
+		writeVLQ(&rv, m.srcColumn-prevSrcColumn)
+
+		prevColumn, prevSource, prevSrcLine, prevSrcColumn = m.genColumn, m.source, m.srcLine, m.srcColumn
+	}
+
+	return rv.String()
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// writeVLQ writes a number as a base64 variable-length quantity
+func writeVLQ(w *strings.Builder, n int) {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	for {
+		digit := v & 0x1f
+		v >>= 5
+		if v > 0 {
+			digit |= 0x20
+		}
+		w.WriteByte(base64Digits[digit])
+		if v == 0 {
+			break
+		}
+	}
+}
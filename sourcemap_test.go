@@ -0,0 +1,115 @@
+package scss
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_VLQ(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{0, "A"},
+		{1, "C"},
+		{-1, "D"},
+		{15, "e"},
+		{-15, "f"},
+		{16, "gB"},
+		{-16, "hB"},
+		{511, "+f"},
+		{512, "ggB"},
+		{123456, "gkxH"},
+	}
+
+	for _, test := range tests {
+		var b strings.Builder
+		writeVLQ(&b, test.n)
+		if b.String() != test.expected {
+			t.Errorf("%d: expected %s, got %s", test.n, test.expected, b.String())
+		}
+	}
+}
+
+func Test_EncodeMappings(t *testing.T) {
+	mappings := []mapping{
+		{genLine: 0, genColumn: 0, source: 0, srcLine: 0, srcColumn: 0},
+		{genLine: 0, genColumn: 5, source: 0, srcLine: 1, srcColumn: 2},
+		{genLine: 2, genColumn: 1, source: 1, srcLine: 0, srcColumn: 4},
+		{genLine: 3, genColumn: 1, source: 0, srcLine: 10, srcColumn: 0},
+	}
+	if got, expected := encodeMappings(mappings), "AAAA,KACE;;CCDE;CDUJ"; got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if got := encodeMappings(nil); got != "" {
+		t.Errorf("expected no mappings, got %s", got)
+	}
+}
+
+func Test_SourceMap(t *testing.T) {
+	src := ".a {\n  b: c;\n  d: e;\n}\n.f { g: h; }\n"
+	tests := []struct {
+		opts     SourceMapOptions
+		style    OutputStyle
+		mappings string
+	}{
+		{SourceMapOptions{Enabled: true}, Nested, "AAAA;CACE;CACA;;AAEF;CAAK"},
+		{SourceMapOptions{Enabled: true, EmbedSources: true}, Expanded, "AAAA;CACE;CACA;;AAEF;CAAK"},
+		{SourceMapOptions{Enabled: true, Inline: true}, Compressed, "AAAA,GACE,IACA,IAEF,GAAK"},
+		{SourceMapOptions{}, Nested, ""},
+	}
+
+	for _, test := range tests {
+		c := NewCompiler(Options{Filename: "in.scss", OutputStyle: test.style, SourceMap: test.opts})
+		res, err := c.CompileString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !test.opts.Enabled {
+			if res.SourceMap != nil || strings.Contains(res.CSS, "sourceMappingURL") {
+				t.Errorf("%+v: expected no source map", test.opts)
+			}
+			continue
+		}
+
+		sm := res.SourceMap
+		if sm.Version != 3 || len(sm.Sources) != 1 || sm.Sources[0] != "in.scss" || sm.Mappings != test.mappings {
+			t.Errorf("%+v: expected version 3, source in.scss and mappings %s; got %+v", test.opts, test.mappings, sm)
+		}
+		if test.opts.EmbedSources != (len(sm.SourcesContent) == 1 && sm.SourcesContent[0] == src) {
+			t.Errorf("%+v: got sources %q", test.opts, sm.SourcesContent)
+		}
+
+		prefix := "\n/*# sourceMappingURL=data:application/json;charset=utf-8;base64,"
+		i := strings.Index(res.CSS, prefix)
+		if !test.opts.Inline {
+			if i >= 0 {
+				t.Errorf("%+v: expected no inline source map", test.opts)
+			}
+			continue
+		}
+		if i < 0 || !strings.HasSuffix(res.CSS, " */\n") {
+			t.Errorf("%+v: expected an inline source map, got %q", test.opts, res.CSS)
+			continue
+		}
+		j, err := base64.StdEncoding.DecodeString(res.CSS[i+len(prefix) : len(res.CSS)-4])
+		var inline SourceMap
+		if err == nil {
+			err = json.Unmarshal(j, &inline)
+		}
+		if err != nil || inline.Mappings != sm.Mappings {
+			t.Errorf("%+v: inline source map %s doesn't match: %v", test.opts, j, err)
+		}
+	}
+}
+
+func Test_RelativeTo(t *testing.T) {
+	sm := &SourceMap{Sources: []string{"/a/b/c.scss", "/a/d/e.scss", "/f.scss"}}
+	sm.RelativeTo("/a/b")
+	if got, expected := strings.Join(sm.Sources, " "), "c.scss ../d/e.scss ../../f.scss"; got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
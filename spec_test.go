@@ -0,0 +1,260 @@
+package scss_test
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/internal/diff"
+	"github.com/thijzert/go-scss/internal/hrx"
+)
+
+var sassSpec = flag.String("sass-spec", "testdata/sass-spec", "Directory with a copy of sass-spec's spec directory")
+
+// sassSpecFailures lists the tests from sass-spec that are known to fail
+const sassSpecFailures = "testdata/sass-spec-failures.txt"
+
+// A specCase is a single test from sass-spec: a directory with an input.scss,
+// and either an output.css or an error file
+type specCase struct {
+	// Name is the path of the directory relative to the spec directory. For
+	// tests inside an archive, the archive counts as a directory.
+	Name string
+
+	// Group is the archive or directory on disk the test was found in
+	Group string
+
+	// Dir is where the files of the test are on disk
+	Dir string
+}
+
+// Test_SassSpec runs the tests from sass-spec. Tests that are known to fail
+// are listed in testdata/sass-spec-failures.txt, and don't count as failures.
+// Run with -update to rewrite that list. By default this only runs the sample
+// in testdata/sass-spec; use -sass-spec to point it at a full copy of
+// https://github.com/sass/sass-spec/tree/main/spec.
+func Test_SassSpec(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "go-scss-spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	cases, err := findSpecCases(*sassSpec, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no tests found in %s", *sassSpec)
+	}
+	known, err := readSpecFailures(sassSpecFailures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passed := make(map[string]int)
+	total := make(map[string]int)
+	failures := make(map[string]bool)
+	for _, sc := range cases {
+		sc := sc
+		total[sc.Group]++
+		t.Run(sc.Name, func(t *testing.T) {
+			if msg := runSpecCase(sc); msg == "" {
+				passed[sc.Group]++
+				if known[sc.Name] && !*update {
+					t.Errorf("passes now; remove it from %s, or run with -update", sassSpecFailures)
+				}
+			} else if known[sc.Name] || *update {
+				failures[sc.Name] = true
+				t.Skip("known failure: " + msg)
+			} else {
+				failures[sc.Name] = true
+				t.Error(msg)
+			}
+		})
+	}
+
+	groups := make([]string, 0, len(total))
+	for group := range total {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	sum := 0
+	for _, group := range groups {
+		t.Logf("%s: %d/%d passed", group, passed[group], total[group])
+		sum += passed[group]
+	}
+	t.Logf("total: %d/%d passed", sum, len(cases))
+
+	if *update {
+		// Keep the entries for tests that weren't run this time
+		for _, sc := range cases {
+			delete(known, sc.Name)
+		}
+		for name := range failures {
+			known[name] = true
+		}
+		if err := writeSpecFailures(sassSpecFailures, known); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// findSpecCases finds all tests in dir. The contents of archives are
+// extracted to tmp.
+func findSpecCases(dir, tmp string) ([]specCase, error) {
+	var rv []specCase
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if _, err := os.Stat(filepath.Join(path, "input.scss")); err == nil {
+				rv = append(rv, specCase{Name: rel, Group: parentGroup(rel), Dir: path})
+			}
+			return nil
+		} else if !strings.HasSuffix(path, ".hrx") {
+			return nil
+		}
+
+		archive, err := hrx.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		group := strings.TrimSuffix(rel, ".hrx")
+		extracted := filepath.Join(tmp, filepath.FromSlash(group))
+		if err := archive.Extract(extracted); err != nil {
+			return err
+		}
+		for _, e := range archive.Entries {
+			if e.Path != "input.scss" && !strings.HasSuffix(e.Path, "/input.scss") {
+				continue
+			}
+			sub := strings.TrimSuffix(strings.TrimSuffix(e.Path, "input.scss"), "/")
+			sc := specCase{Name: group, Group: group, Dir: extracted}
+			if sub != "" {
+				sc.Name += "/" + sub
+				sc.Dir = filepath.Join(extracted, filepath.FromSlash(sub))
+			}
+			rv = append(rv, sc)
+		}
+		return nil
+	})
+	return rv, err
+}
+
+func parentGroup(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i]
+	}
+	return "."
+}
+
+// runSpecCase compiles a test, and describes how the outcome differs from what
+// was expected. It returns an empty string if the test passes.
+func runSpecCase(sc specCase) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+
+	c := scss.NewCompiler(scss.Options{OutputStyle: scss.Expanded})
+	res, err := c.CompileFile(filepath.Join(sc.Dir, "input.scss"))
+
+	if expected, rerr := ioutil.ReadFile(filepath.Join(sc.Dir, "output.css")); rerr == nil {
+		if err != nil {
+			return fmt.Sprintf("unexpected error: %v", err)
+		}
+		if d := diff.Unified("output.css", "observed", normaliseCSS(string(expected)), normaliseCSS(res.CSS)); d != "" {
+			return "output differs:\n" + d
+		}
+		return ""
+	}
+
+	if expected, rerr := ioutil.ReadFile(filepath.Join(sc.Dir, "error")); rerr == nil {
+		if err == nil {
+			return fmt.Sprintf("expected an error, but it compiled to:\n%s", res.CSS)
+		}
+		// Only compare the message, since the snippets are laid out
+		// differently
+		want := strings.SplitN(string(expected), "\n", 2)[0]
+		diags := scss.Diagnose(err, "", "")
+		got := ""
+		if len(diags) > 0 {
+			got = "Error: " + diags[0].Message
+		}
+		if got != want {
+			return fmt.Sprintf("expected error %q, got %q", want, got)
+		}
+		return ""
+	}
+
+	return "test has neither output.css nor error"
+}
+
+// normaliseCSS removes trailing whitespace and blank lines, like the
+// sass-spec runner does. Since go-scss indents with tabs rather than two
+// spaces, it also replaces those.
+func normaliseCSS(css string) string {
+	lines := strings.Split(strings.Replace(css, "\r\n", "\n", -1), "\n")
+	rv := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		indent := len(line) - len(strings.TrimLeft(line, "\t"))
+		line = strings.Repeat("  ", indent) + line[indent:]
+		if line != "" {
+			rv = append(rv, line)
+		}
+	}
+	return strings.Join(rv, "\n") + "\n"
+}
+
+// readSpecFailures reads the list of tests that are known to fail
+func readSpecFailures(filename string) (map[string]bool, error) {
+	rv := make(map[string]bool)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return rv, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && line[0] != '#' {
+			rv[line] = true
+		}
+	}
+	return rv, s.Err()
+}
+
+func writeSpecFailures(filename string, failures map[string]bool) error {
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	contents := "# Tests from sass-spec that are known to fail. Regenerate this list with\n"
+	contents += "#   go test -run Test_SassSpec -update -sass-spec path/to/sass-spec/spec\n"
+	for _, name := range names {
+		contents += name + "\n"
+	}
+	return ioutil.WriteFile(filename, []byte(contents), 0644)
+}
@@ -1,153 +1,403 @@
 package scss
 
 import (
+	"strings"
+
 	"github.com/thijzert/go-scss/lexer"
 )
 
+// Token types follow CSS Syntax Level 3, section 4 ("Tokenization"), with a
+// few additions for SCSS. The value of every token is its source text,
+// including quotes, escapes and the like.
 const (
 	WhitespaceToken lexer.TokenType = iota
-	OperatorToken
-	SymbolToken
+	IdentToken
+	// FunctionToken is a name directly followed by '('. The '(' is part of
+	// the value.
+	FunctionToken
+	AtKeywordToken
+	HashToken
 	StringToken
+	// BadStringToken is a string with an unescaped newline in it. The
+	// newline is not part of the value.
+	BadStringToken
+	// URLToken is an unquoted url(...), including the 'url(' and ')'.
+	// url("...") is a FunctionToken followed by a StringToken instead.
+	URLToken
+	BadURLToken
+	NumberToken
+	PercentageToken
+	DimensionToken
+	UnicodeRangeToken
+	// CDOToken and CDCToken are '<!--' and '-->'
+	CDOToken
+	CDCToken
+	// DelimToken is any other single code point. Unlike the spec, this
+	// includes the colon, semicolon, comma and brackets.
+	DelimToken
+
+	// VariableToken is a '$' directly followed by a name
+	VariableToken
+	// InterpolationToken is the '#{' that starts an interpolation. The
+	// closing '}' is a DelimToken.
+	InterpolationToken
+	// PlaceholderToken is a '%' directly followed by a name
+	PlaceholderToken
+
+	// Comments are set aside by the TokenRing, so the parser never sees them.
+	// Both /* block comments */ and // line comments are comments.
+	CommentToken
 )
 
+const whitespace = " \t\n\r\f"
+
 func nullState(l *lexer.L) lexer.StateFunc {
-	peek := l.Peek()
-	if peek == lexer.EOFRune {
+	r := l.Next()
+	if r == lexer.EOFRune {
 		return nil
-	} else if peek == ' ' || peek == '\t' || peek == '\n' || peek == '\r' {
-		return whitespaceState
-	} else if peek == '/' {
-		return commentState
-	} else if peek == '"' {
-		return stringState
-	} else if isOperator(peek) {
+	}
+	p1, p2 := peekAt(l, 1), peekAt(l, 2)
+
+	if isWhitespace(r) {
+		l.Take(whitespace)
+		l.Emit(WhitespaceToken)
+	} else if r == '"' || r == '\'' {
+		stringState(l, r)
+	} else if r == '/' && p1 == '*' {
+		blockComment(l)
+	} else if r == '/' && p1 == '/' {
+		lineComment(l)
+	} else if r == '#' && p1 == '{' {
+		l.Next()
+		l.Emit(InterpolationToken)
+	} else if r == '#' && (isNameCode(p1) || isValidEscape(p1, p2)) {
+		consumeName(l)
+		l.Emit(HashToken)
+	} else if r == '$' && (isNameCode(p1) || isValidEscape(p1, p2)) {
+		consumeName(l)
+		l.Emit(VariableToken)
+	} else if r == '%' && (isNameCode(p1) || isValidEscape(p1, p2)) {
+		consumeName(l)
+		l.Emit(PlaceholderToken)
+	} else if startsNumber(r, p1, p2) {
+		l.Rewind()
+		numericState(l)
+	} else if r == '-' && p1 == '-' && p2 == '>' {
+		l.Next()
+		l.Next()
+		l.Emit(CDCToken)
+	} else if r == '<' && p1 == '!' && p2 == '-' && peekAt(l, 3) == '-' {
+		l.Next()
 		l.Next()
-		l.Emit(OperatorToken)
-		return nullState
+		l.Next()
+		l.Emit(CDOToken)
+	} else if r == '@' && startsIdent(p1, p2, peekAt(l, 3)) {
+		consumeName(l)
+		l.Emit(AtKeywordToken)
+	} else if (r == 'u' || r == 'U') && p1 == '+' && (isHexDigit(p2) || p2 == '?') {
+		l.Next()
+		unicodeRangeState(l)
+	} else if startsIdent(r, p1, p2) {
+		l.Rewind()
+		identLikeState(l)
+	} else {
+		l.Emit(DelimToken)
+	}
+
+	return nullState
+}
+
+// peekAt returns the rune n positions ahead, without consuming anything
+func peekAt(l *lexer.L, n int) rune {
+	var r rune
+	for i := 0; i < n; i++ {
+		r = l.Next()
+	}
+	for i := 0; i < n; i++ {
+		l.Rewind()
 	}
-	return symbolState
+	return r
 }
 
 func isWhitespace(r rune) bool {
-	if r == ' ' {
-		return true
-	} else if r == '\t' {
-		return true
-	} else if r == '\n' {
-		return true
-	} else if r == '\r' {
-		return true
-	} else {
-		return false
-	}
-}
-func isOperator(r rune) bool {
-	if r == '.' {
-		return true
-	} else if r == '{' {
-		return true
-	} else if r == '}' {
-		return true
-	} else if r == '>' {
-		return true
-	} else if r == '+' {
-		return true
-	} else if r == '(' {
-		return true
-	} else if r == ')' {
-		return true
-	} else if r == '[' {
-		return true
-	} else if r == ']' {
-		return true
-	} else if r == ':' {
-		return true
-	} else if r == ';' {
-		return true
-	} else if r == '\'' {
-		return true
-	} else if r == '"' {
-		return true
-	} else if r == '^' {
-		return true
-	} else if r == '=' {
-		return true
-	} else if r == ',' {
-		return true
-	} else if r == '*' {
-		return true
-	} else if r == '&' {
-		return true
-	} else {
-		return false
+	return r == ' ' || r == '\t' || isNewline(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\f'
+}
+
+func isDecimal(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDecimal(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// isNameStart reports whether r can start a name
+func isNameStart(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r >= 0x80
+}
+
+// isNameCode reports whether r can appear in a name
+func isNameCode(r rune) bool {
+	return isNameStart(r) || isDecimal(r) || r == '-'
+}
+
+func isNonPrintable(r rune) bool {
+	return (r >= 0 && r <= 8) || r == 0x0b || (r >= 0x0e && r <= 0x1f) || r == 0x7f
+}
+
+// isValidEscape reports whether the two runes start an escape
+func isValidEscape(r0, r1 rune) bool {
+	return r0 == '\\' && !isNewline(r1)
+}
+
+// startsIdent reports whether the three runes start an identifier
+func startsIdent(r0, r1, r2 rune) bool {
+	if r0 == '-' {
+		return isNameStart(r1) || r1 == '-' || isValidEscape(r1, r2)
+	} else if r0 == '\\' {
+		return isValidEscape(r0, r1)
 	}
+	return isNameStart(r0)
 }
 
-func whitespaceState(l *lexer.L) lexer.StateFunc {
-	l.Take(" \t\n\r")
-	l.Ignore()
-	l.Emit(WhitespaceToken)
+// startsNumber reports whether the three runes start a number
+func startsNumber(r0, r1, r2 rune) bool {
+	if r0 == '+' || r0 == '-' {
+		return isDecimal(r1) || (r1 == '.' && isDecimal(r2))
+	} else if r0 == '.' {
+		return isDecimal(r1)
+	}
+	return isDecimal(r0)
+}
 
-	return nullState
+// consumeEscape consumes an escape, after the backslash
+func consumeEscape(l *lexer.L) {
+	r := l.Next()
+	if !isHexDigit(r) {
+		// Anything else stands for itself, and EOF for U+FFFD
+		return
+	}
+	for i := 1; i < 6 && isHexDigit(l.Peek()); i++ {
+		l.Next()
+	}
+	if r := l.Next(); r == '\r' && l.Peek() == '\n' {
+		l.Next()
+	} else if !isWhitespace(r) {
+		l.Rewind()
+	}
 }
 
-func symbolState(l *lexer.L) lexer.StateFunc {
+// consumeName consumes as many name code points and escapes as possible
+func consumeName(l *lexer.L) {
 	for {
 		r := l.Next()
-		if r == lexer.EOFRune {
-			l.Emit(SymbolToken)
-			return nil
-		} else if isOperator(r) || isWhitespace(r) {
+		if isNameCode(r) {
+			continue
+		} else if r == '\\' && !isNewline(l.Peek()) {
+			consumeEscape(l)
+			continue
+		}
+		l.Rewind()
+		return
+	}
+}
+
+// consumeNumber consumes a number, without its unit
+func consumeNumber(l *lexer.L) {
+	if r := l.Peek(); r == '+' || r == '-' {
+		l.Next()
+	}
+	l.Take("0123456789")
+	if peekAt(l, 1) == '.' && isDecimal(peekAt(l, 2)) {
+		l.Next()
+		l.Take("0123456789")
+	}
+	if r := peekAt(l, 1); r == 'e' || r == 'E' {
+		if r2 := peekAt(l, 2); isDecimal(r2) {
+			l.Next()
+			l.Take("0123456789")
+		} else if (r2 == '+' || r2 == '-') && isDecimal(peekAt(l, 3)) {
+			l.Next()
+			l.Next()
+			l.Take("0123456789")
+		}
+	}
+}
+
+func numericState(l *lexer.L) {
+	consumeNumber(l)
+	if startsIdent(peekAt(l, 1), peekAt(l, 2), peekAt(l, 3)) {
+		consumeName(l)
+		l.Emit(DimensionToken)
+	} else if l.Peek() == '%' {
+		l.Next()
+		l.Emit(PercentageToken)
+	} else {
+		l.Emit(NumberToken)
+	}
+}
+
+// identLikeState consumes an identifier, a function name or a url()
+func identLikeState(l *lexer.L) {
+	consumeName(l)
+	if l.Peek() != '(' {
+		l.Emit(IdentToken)
+		return
+	}
+
+	isURL := strings.EqualFold(l.Current(), "url")
+	l.Next()
+	if isURL {
+		// Quoted URLs are a function with a string argument
+		n := 1
+		r := l.Next()
+		for isWhitespace(r) {
+			r = l.Next()
+			n++
+		}
+		for i := 0; i < n; i++ {
 			l.Rewind()
-			l.Emit(SymbolToken)
-			return nullState
+		}
+		if r != '"' && r != '\'' {
+			urlState(l)
+			return
 		}
 	}
+	l.Emit(FunctionToken)
 }
 
-func commentState(l *lexer.L) lexer.StateFunc {
-	peek := l.Next()
-	peek = l.Peek()
-	if peek == '/' {
-		// Line comment
-		for peek != lexer.EOFRune && peek != '\n' {
-			peek = l.Next()
+// urlState consumes an unquoted url(), after the '('
+func urlState(l *lexer.L) {
+	l.Take(whitespace)
+	for {
+		r := l.Next()
+		if r == ')' {
+			l.Emit(URLToken)
+			return
+		} else if r == lexer.EOFRune {
+			l.Error("Unterminated url()")
+			return
+		} else if isWhitespace(r) {
+			l.Take(whitespace)
+			if r := l.Next(); r == ')' {
+				l.Emit(URLToken)
+				return
+			} else if r == lexer.EOFRune {
+				l.Error("Unterminated url()")
+				return
+			}
+			badURLState(l)
+			return
+		} else if r == '"' || r == '\'' || r == '(' || isNonPrintable(r) {
+			badURLState(l)
+			return
+		} else if r == '\\' {
+			if isNewline(l.Peek()) {
+				badURLState(l)
+				return
+			}
+			consumeEscape(l)
+		}
+	}
+}
+
+// badURLState consumes the remnants of a bad url(), up to the ')'
+func badURLState(l *lexer.L) {
+	for {
+		r := l.Next()
+		if r == ')' {
+			l.Emit(BadURLToken)
+			return
+		} else if r == lexer.EOFRune {
+			l.Error("Unterminated url()")
+			return
+		} else if r == '\\' && !isNewline(l.Peek()) {
+			consumeEscape(l)
 		}
-		l.Ignore()
-	} else if peek == '*' {
-		// Block comment
-		for {
-			for peek != lexer.EOFRune && peek != '*' {
-				peek = l.Next()
+	}
+}
+
+// unicodeRangeState consumes a unicode range, after the 'u+'
+func unicodeRangeState(l *lexer.L) {
+	n := 0
+	for n < 6 && isHexDigit(l.Peek()) {
+		l.Next()
+		n++
+	}
+	wildcard := false
+	for n < 6 && l.Peek() == '?' {
+		l.Next()
+		n++
+		wildcard = true
+	}
+	if !wildcard {
+		if peekAt(l, 1) == '-' && isHexDigit(peekAt(l, 2)) {
+			l.Next()
+			for n := 0; n < 6 && isHexDigit(l.Peek()); n++ {
+				l.Next()
 			}
-			if peek != lexer.EOFRune {
-				peek = l.Next()
-				if peek == lexer.EOFRune || peek == '/' {
-					l.Ignore()
-					break
+		}
+	}
+	l.Emit(UnicodeRangeToken)
+}
+
+// stringState consumes a string, after the opening quote
+func stringState(l *lexer.L, quote rune) {
+	for {
+		r := l.Next()
+		if r == quote {
+			l.Emit(StringToken)
+			return
+		} else if r == lexer.EOFRune {
+			l.Error("Unterminated string")
+			return
+		} else if isNewline(r) {
+			l.Rewind()
+			l.Emit(BadStringToken)
+			return
+		} else if r == '\\' {
+			if r := l.Peek(); r == lexer.EOFRune {
+				continue
+			} else if isNewline(r) {
+				// An escaped newline continues the string on the next line
+				if l.Next() == '\r' && l.Peek() == '\n' {
+					l.Next()
 				}
+			} else {
+				consumeEscape(l)
 			}
 		}
-	} else {
-		// Well that's weird. Let's treat the slash as an operator.
-		l.Emit(OperatorToken)
 	}
-	return nullState
 }
 
-func stringState(l *lexer.L) lexer.StateFunc {
-	peek := l.Next()
-	if peek != '"' {
-		l.Rewind()
-		return nullState
+// blockComment consumes a /* comment */, after the '/'
+func blockComment(l *lexer.L) {
+	l.Next()
+	for {
+		r := l.Next()
+		if r == lexer.EOFRune {
+			l.Error("Unterminated comment")
+			return
+		} else if r == '*' && l.Peek() == '/' {
+			l.Next()
+			l.Emit(CommentToken)
+			return
+		}
 	}
-	nope := false
-	peek = l.Next()
-	for peek != '"' || nope {
-		peek = l.Next()
-		nope = (peek == '\\')
+}
+
+// lineComment consumes a // comment, after the first '/'. The newline is not
+// part of the comment.
+func lineComment(l *lexer.L) {
+	for r := l.Next(); r != lexer.EOFRune; r = l.Next() {
+		if isNewline(r) {
+			l.Rewind()
+			break
+		}
 	}
-	l.Emit(StringToken)
-	return nullState
+	l.Emit(CommentToken)
 }
@@ -0,0 +1,356 @@
+package scss
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/thijzert/go-scss/lexer"
+)
+
+// allTokens reads every token from the lexer
+func allTokens(l *lexer.L) []lexer.Token {
+	var rv []lexer.Token
+	for {
+		tok, done := l.NextToken()
+		if done {
+			return rv
+		}
+		rv = append(rv, *tok)
+	}
+}
+
+func Test_PullLexerMatchesGoroutine(t *testing.T) {
+	files, err := filepath.Glob("test_vectors/source/*.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l := lexer.New(string(src), nullState)
+		l.Start()
+		expected := allTokens(l)
+		got := allTokens(lexer.New(string(src), nullState))
+
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected tokens:\n%v\ngot:\n%v", name, expected, got)
+		}
+	}
+}
+
+var tokenNames = map[lexer.TokenType]string{
+	WhitespaceToken:    "ws",
+	IdentToken:         "ident",
+	FunctionToken:      "function",
+	AtKeywordToken:     "at-keyword",
+	HashToken:          "hash",
+	StringToken:        "string",
+	BadStringToken:     "bad-string",
+	URLToken:           "url",
+	BadURLToken:        "bad-url",
+	NumberToken:        "number",
+	PercentageToken:    "percentage",
+	DimensionToken:     "dimension",
+	UnicodeRangeToken:  "unicode-range",
+	CDOToken:           "CDO",
+	CDCToken:           "CDC",
+	DelimToken:         "delim",
+	VariableToken:      "variable",
+	InterpolationToken: "interpolation",
+	PlaceholderToken:   "placeholder",
+	CommentToken:       "comment",
+	lexer.ErrorToken:   "error",
+}
+
+// The cases are based on section 4 of CSS Syntax Level 3. Every token is
+// written as its type, followed by its value in parentheses.
+var tokenizerTests = []struct {
+	src      string
+	expected string
+}{
+	// Whitespace and comments
+	{"", ""},
+	{" \t\n\r\f", "ws( \t\n\r\f)"},
+	{"/* a */b", "comment(/* a */) ident(b)"},
+	{"/* a ** / */", "comment(/* a ** / */)"},
+	{"/* unterminated", "error(Unterminated comment)"},
+	{"a /* b", "ident(a) ws( ) error(Unterminated comment)"},
+	{"a // b\nc", "ident(a) ws( ) comment(// b) ws(\n) ident(c)"},
+	{"a/b", "ident(a) delim(/) ident(b)"},
+
+	// Identifiers and functions
+	{"foo-bar_baz", "ident(foo-bar_baz)"},
+	{"-foo", "ident(-foo)"},
+	{"--custom", "ident(--custom)"},
+	{"_x9", "ident(_x9)"},
+	{"ünïcödé", "ident(ünïcödé)"},
+	{`\31 0px`, `ident(\31 0px)`},
+	{`a\:b`, `ident(a\:b)`},
+	{`\`, `ident(\)`}, // An escape at EOF stands for U+FFFD
+	{"\\\n", "delim(\\) ws(\n)"},
+	{"rgba(0,0,0)", "function(rgba() number(0) delim(,) number(0) delim(,) number(0) delim())"},
+	{"-webkit-calc(1px)", "function(-webkit-calc() dimension(1px) delim())"},
+
+	// At-keywords and hashes
+	{"@import", "at-keyword(@import)"},
+	{"@-moz-document", "at-keyword(@-moz-document)"},
+	{"@ x", "delim(@) ws( ) ident(x)"},
+	{"@1", "delim(@) number(1)"},
+	{"#fff", "hash(#fff)"},
+	{"#123", "hash(#123)"},
+	{"#-a", "hash(#-a)"},
+	{"# a", "delim(#) ws( ) ident(a)"},
+
+	// Strings
+	{`"a b"`, `string("a b")`},
+	{`'a "b"'`, `string('a "b"')`},
+	{`"a\"b"`, `string("a\"b")`},
+	{`'a\'b'`, `string('a\'b')`},
+	{"\"a\\\nb\"", "string(\"a\\\nb\")"},
+	{"\"a\nb\"", "bad-string(\"a) ws(\n) ident(b) error(Unterminated string)"},
+	{`"unterminated`, `error(Unterminated string)`},
+	{`a 'b`, `ident(a) ws( ) error(Unterminated string)`},
+	{`"a\`, `error(Unterminated string)`},
+
+	// URLs
+	{"url(a.png)", "url(url(a.png))"},
+	{"url(  a.png  )", "url(url(  a.png  ))"},
+	{"URL(http://x.com/a?b=c)", "url(URL(http://x.com/a?b=c))"},
+	{`url(a\)b)`, `url(url(a\)b))`},
+	{"url()", "url(url())"},
+	{`url("a.png")`, `function(url() string("a.png") delim())`},
+	{`url( 'a.png' )`, `function(url() ws( ) string('a.png') ws( ) delim())`},
+	{"url(a b)", "bad-url(url(a b))"},
+	{"url(a\"b) c", "bad-url(url(a\"b)) ws( ) ident(c)"},
+	{"url(a(b) c", "bad-url(url(a(b)) ws( ) ident(c)"},
+	{"url(unterminated", "error(Unterminated url())"},
+	{"url(a ", "error(Unterminated url())"},
+	{"url(a b", "error(Unterminated url())"},
+
+	// Numbers
+	{"12", "number(12)"},
+	{"+12", "number(+12)"},
+	{"-12", "number(-12)"},
+	{"1.5", "number(1.5)"},
+	{".5", "number(.5)"},
+	{"-.5", "number(-.5)"},
+	{"1.", "number(1) delim(.)"},
+	{"1e3", "number(1e3)"},
+	{"1E+3", "number(1E+3)"},
+	{"1e-3", "number(1e-3)"},
+	{"1em", "dimension(1em)"},
+	{"1e", "dimension(1e)"},
+	{"1e+", "dimension(1e) delim(+)"},
+	{"10px-5", "dimension(10px-5)"},
+	{"1-5", "number(1) number(-5)"},
+	{"50%", "percentage(50%)"},
+	{"-1.5e2%", "percentage(-1.5e2%)"},
+	{"12px/1.5", "dimension(12px) delim(/) number(1.5)"},
+	{`1\2`, `dimension(1\2)`},
+	{"+ 1", "delim(+) ws( ) number(1)"},
+	{". 5", "delim(.) ws( ) number(5)"},
+
+	// Unicode ranges
+	{"U+26", "unicode-range(U+26)"},
+	{"u+0-7F", "unicode-range(u+0-7F)"},
+	{"u+4??", "unicode-range(u+4??)"},
+	{"u+4??-7", "unicode-range(u+4??) number(-7)"},
+	{"u+x", "ident(u) delim(+) ident(x)"},
+
+	// CDO and CDC
+	{"<!-- -->", "CDO(<!--) ws( ) CDC(-->)"},
+	{"<!-", "delim(<) delim(!) delim(-)"},
+	{"a-->", "ident(a--) delim(>)"},
+
+	// Delimiters
+	{"a{b:c;d,e}", "ident(a) delim({) ident(b) delim(:) ident(c) delim(;) ident(d) delim(,) ident(e) delim(})"},
+	{"[a]", "delim([) ident(a) delim(])"},
+	{"!important", "delim(!) ident(important)"},
+	{"a>b~c+d&", "ident(a) delim(>) ident(b) delim(~) ident(c) delim(+) ident(d) delim(&)"},
+	{"^=|=*=", "delim(^) delim(=) delim(|) delim(=) delim(*) delim(=)"},
+
+	// SCSS additions
+	{"$var", "variable($var)"},
+	{"$my-var_2", "variable($my-var_2)"},
+	{"$ x", "delim($) ws( ) ident(x)"},
+	{"-$x", "delim(-) variable($x)"},
+	{"#{$x}", "interpolation(#{) variable($x) delim(})"},
+	{"a-#{b}", "ident(a-) interpolation(#{) ident(b) delim(})"},
+	{"%placeholder", "placeholder(%placeholder)"},
+	{"% x", "delim(%) ws( ) ident(x)"},
+	{"10 % 3", "number(10) ws( ) delim(%) ws( ) number(3)"},
+}
+
+func Test_Tokenizer(t *testing.T) {
+	for _, test := range tokenizerTests {
+		var got []string
+		for _, tok := range allTokens(lexer.New(test.src, nullState)) {
+			got = append(got, tokenNames[tok.Type]+"("+tok.Value+")")
+		}
+		if strings.Join(got, " ") != test.expected {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", test.src, test.expected, strings.Join(got, " "))
+		}
+	}
+}
+
+func Test_TokenPositions(t *testing.T) {
+	toks := allTokens(lexer.New("a {\n  b: 'ü';\n}", nullState))
+	expected := "1:0 1:1 1:2 1:3 2:2 2:3 2:4 2:5 2:8 2:9 3:0"
+	var got []string
+	for _, tok := range toks {
+		got = append(got, fmt.Sprintf("%d:%d", tok.Line, tok.Column))
+	}
+	if strings.Join(got, " ") != expected {
+		t.Errorf("expected positions %s, got %s", expected, strings.Join(got, " "))
+	}
+}
+
+func Test_ReaderLexerMatchesString(t *testing.T) {
+	files, err := filepath.Glob("test_vectors/source/*.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := allTokens(lexer.New(string(src), nullState))
+		got := allTokens(lexer.NewReader(iotest.OneByteReader(strings.NewReader(string(src))), nullState))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected tokens:\n%v\ngot:\n%v", name, expected, got)
+		}
+	}
+
+	for _, test := range tokenizerTests {
+		expected := allTokens(lexer.New(test.src, nullState))
+		got := allTokens(lexer.NewReader(iotest.OneByteReader(strings.NewReader(test.src)), nullState))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%q: expected tokens:\n%v\ngot:\n%v", test.src, expected, got)
+		}
+	}
+}
+
+func Test_LexerErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{".a { b: 'c; }", "1:9-1:14 Unterminated string; 1:14-1:14 Expected: '}'"},
+		{".a { b: 'c\n; }", "1:9-1:11 Unterminated string"},
+		{".a { b: c; }\n/* d", "2:1-2:5 Unterminated comment"},
+		{".a { b: url(c); }\n.d { e: url(f", "2:9-2:14 Unterminated url(); 2:14-2:14 Expected: '}'"},
+		{".a { b: url(c d); }", "1:9-1:17 Invalid url()"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		var got []string
+		for _, d := range Diagnose(err, "", test.src) {
+			got = append(got, fmt.Sprintf("%s-%s %s", d.Span.Start, d.Span.End, d.Message))
+		}
+		if strings.Join(got, "; ") != test.expected {
+			t.Errorf("%q: expected errors %q, got %q", test.src, test.expected, strings.Join(got, "; "))
+		}
+	}
+}
+
+func Test_ErrorSnippet(t *testing.T) {
+	// The tab in front of the declaration is copied, so the carets line up
+	src := ".a {\n\tb: 'c;\n}\n"
+	_, err := Parse(src)
+	diags := Diagnose(err, "a.scss", src)
+	if len(diags) == 0 {
+		t.Fatal("expected an error")
+	}
+	d := diags[0]
+	expected := "  ,\n2 | \tb: 'c;\n  | \t   ^^^\n  '\n"
+	if d.Snippet != expected {
+		t.Errorf("expected snippet:\n%s\ngot:\n%s", expected, d.Snippet)
+	}
+	if d.Span.File != "a.scss" || d.Code != ErrSyntax {
+		t.Errorf("expected a syntax error in a.scss, got %s in %s", d.Code, d.Span.File)
+	}
+}
+
+// largeStylesheet concatenates the test vectors until the result is at least
+// size bytes long
+func largeStylesheet(b *testing.B, size int) string {
+	files, err := filepath.Glob("test_vectors/source/*.scss")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var all []string
+	for _, name := range files {
+		// Leave out the vectors that aren't supposed to compile
+		errFile := filepath.Join("test_vectors/expected", strings.TrimSuffix(filepath.Base(name), ".scss")+".err")
+		if _, err := os.Stat(errFile); err == nil {
+			continue
+		}
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		all = append(all, string(src))
+	}
+	one := strings.Join(all, "\n")
+	return strings.Repeat(one+"\n", size/len(one)+1)
+}
+
+func BenchmarkLexer(b *testing.B) {
+	src := largeStylesheet(b, 1<<20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := lexer.New(src, nullState)
+		for _, done := l.NextToken(); !done; _, done = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkLexerReader(b *testing.B) {
+	src := largeStylesheet(b, 1<<20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := lexer.NewReader(strings.NewReader(src), nullState)
+		for _, done := l.NextToken(); !done; _, done = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkLexerGoroutine(b *testing.B) {
+	src := largeStylesheet(b, 1<<20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := lexer.New(src, nullState)
+		l.Start()
+		for _, done := l.NextToken(); !done; _, done = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := largeStylesheet(b, 1<<20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,37 +1,103 @@
 package scss
 
 import (
+	"fmt"
+	"runtime"
+
 	"github.com/thijzert/go-scss/lexer"
 )
 
 // It's actually more of a buffer, but this sounds way cooler
+//
+// Positions in the stream count tokens from the start of the file. The buffer
+// only holds the tokens from position base onwards: those before the oldest
+// mark are released as the parser moves on, so memory use depends on how far
+// the parser looks back rather than on the size of the file.
 type TokenRing struct {
 	l      *lexer.L
 	buffer []*lexer.Token
+	base   int
 	index  int
-	bts    backtrackStack
+	marks  markStack
 	eof    bool
+
+	// comments holds all comments read so far
+	comments []*lexer.Token
+
+	// errs holds the errors reported by the lexer
+	errs ErrorList
 }
 
+// minRelease is the least number of tokens released at a time, so the buffer
+// isn't copied for every token
+const minRelease = 64
+
 func NewTokenRing(l *lexer.L) *TokenRing {
-	rv := &TokenRing{l, make([]*lexer.Token, 0, 10), 0, newBacktrackStack(), false}
+	rv := &TokenRing{l, make([]*lexer.Token, 0, minRelease), 0, 0, markStack{}, false, nil, nil}
 	return rv
 }
 
+// Next returns the next token, or nil at the end of the stream. Reading past
+// the end still moves the position, so a Rewind afterwards ends up at the end
+// again.
 func (t *TokenRing) Next() *lexer.Token {
-	if t.eof {
+	if t.index < t.base+len(t.buffer) {
+		rv := t.buffer[t.index-t.base]
+		t.index++
+		return rv
+	} else if t.eof {
+		t.index++
 		return nil
-	} else if t.index == len(t.buffer) {
-		n, _ := t.l.NextToken()
-		if n == nil {
-			t.eof = true
-			return nil
+	}
+
+	n, _ := t.l.NextToken()
+	for n != nil && (n.Type == CommentToken || n.Type == lexer.ErrorToken) {
+		if n.Type == CommentToken {
+			t.comments = append(t.comments, n)
+		} else {
+			// The lexer stops after an error, so this is the end
+			t.errs = append(t.errs, parseError(n.Value, nil, n))
 		}
-		t.buffer = append(t.buffer, n)
+		n, _ = t.l.NextToken()
 	}
-	rv := t.buffer[t.index]
+	if n == nil {
+		t.eof = true
+		t.index++
+		return nil
+	}
+
+	// Bad strings and URLs are passed on, so the parser can carry on
+	if n.Type == BadStringToken {
+		t.errs = append(t.errs, parseError("Unterminated string", nil, n))
+	} else if n.Type == BadURLToken {
+		t.errs = append(t.errs, parseError("Invalid url()", nil, n))
+	}
+
+	t.release()
+	t.buffer = append(t.buffer, n)
 	t.index++
-	return rv
+	return n
+}
+
+// release drops the tokens that can no longer be returned to. That's all
+// tokens before the oldest mark, except the one before the current position
+// so Rewind keeps working.
+func (t *TokenRing) release() {
+	keep := t.index - 1
+	if len(t.marks) > 0 && t.marks[0].index < keep {
+		keep = t.marks[0].index
+	}
+	n := keep - t.base
+	if n < minRelease || n < len(t.buffer)/2 {
+		return
+	}
+
+	m := copy(t.buffer, t.buffer[n:])
+	for i := m; i < len(t.buffer); i++ {
+		t.buffer[i] = nil
+	}
+	t.buffer = t.buffer[:m]
+	t.base = keep
 }
 
 func (t *TokenRing) Rewind() {
@@ -58,19 +124,75 @@ func (t *TokenRing) Ignore(types ...lexer.TokenType) *lexer.Token {
 	return rv
 }
 
-// Mark a position in the stream for later use
+// Mark a position in the stream for later use. Every Mark should be followed
+// by either a Backtrack or an Unmark.
 func (t *TokenRing) Mark() {
-	t.bts.push(t.index)
+	t.marks.push(t.index)
 }
 
 // Return to the last marked location
 func (t *TokenRing) Backtrack() {
-	t.index = t.bts.pop()
+	if index, ok := t.marks.pop("Backtrack"); ok {
+		t.index = index
+	}
 }
 
 // Remove the last made mark
 func (t *TokenRing) Unmark() {
-	t.bts.pop()
+	t.marks.pop("Unmark")
+}
+
+// Return the last token consumed that isn't one of the listed types to ignore.
+// Only the tokens since the oldest mark are considered.
+func (t *TokenRing) LastSignificant(types ...lexer.TokenType) *lexer.Token {
+	for i := t.end() - 1; i >= t.base; i-- {
+		tok := t.buffer[i-t.base]
+		ignored := false
+		for _, typ := range types {
+			if tok.Type == typ {
+				ignored = true
+			}
+		}
+		if !ignored {
+			return tok
+		}
+	}
+	return nil
+}
+
+// since returns the tokens consumed since the stream was at position start,
+// which must be at or after the last mark
+func (t *TokenRing) since(start int) []*lexer.Token {
+	if end := t.end(); start < end {
+		return append([]*lexer.Token(nil), t.buffer[start-t.base:end-t.base]...)
+	}
+	return nil
+}
+
+// end returns the current position, not counting any reads past the end of
+// the stream
+func (t *TokenRing) end() int {
+	if t.index > t.base+len(t.buffer) {
+		return t.base + len(t.buffer)
+	}
+	return t.index
+}
+
+// Balanced checks that every Mark has been matched by a Backtrack or Unmark.
+// It is only checked in debug builds; see markStack.
+func (t *TokenRing) Balanced() {
+	t.marks.checkEmpty()
+}
+
+// Errors returns the errors the lexer reported so far, including bad strings
+// and URLs
+func (t *TokenRing) Errors() ErrorList {
+	return t.errs
+}
+
+// Comments returns the comments encountered so far
+func (t *TokenRing) Comments() []*lexer.Token {
+	return t.comments
 }
 
 func (t *TokenRing) EOF() bool {
@@ -84,39 +206,42 @@ func (t *TokenRing) Peek() *lexer.Token {
 }
 
 // A stack that keeps track of your marks
-type backtrackNode struct {
-	index int
-	next  *backtrackNode
-}
+type markStack []mark
 
-type backtrackStack struct {
-	start *backtrackNode
-}
+type mark struct {
+	index int
 
-func newBacktrackStack() backtrackStack {
-	return backtrackStack{}
+	// caller is where the mark was made. It is only recorded in debug builds.
+	caller string
 }
 
-func (s *backtrackStack) push(index int) {
-	node := &backtrackNode{index: index}
-	if s.start == nil {
-		s.start = node
-	} else {
-		node.next = s.start
-		s.start = node
+func (s *markStack) push(index int) {
+	m := mark{index: index}
+	if debugMarks {
+		if _, file, line, ok := runtime.Caller(2); ok {
+			m.caller = fmt.Sprintf("%s:%d", file, line)
+		}
 	}
+	*s = append(*s, m)
 }
 
-func (s *backtrackStack) pop() int {
-	if s.start == nil {
-		return -1
-	} else {
-		n := s.start
-		s.start = n.next
-		return n.index
+// pop removes the last mark. In debug builds, popping more marks than were
+// pushed panics; otherwise it just reports that there was no mark.
+func (s *markStack) pop(op string) (int, bool) {
+	if len(*s) == 0 {
+		if debugMarks {
+			panic(op + " without a matching Mark")
+		}
+		return 0, false
 	}
+	m := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return m.index, true
 }
 
-func (s *backtrackStack) clear() {
-	s.start = nil
+// checkEmpty panics in debug builds if there are marks left
+func (s markStack) checkEmpty() {
+	if debugMarks && len(s) > 0 {
+		panic(fmt.Sprintf("%d marks were never removed; the last one was made at %s", len(s), s[len(s)-1].caller))
+	}
 }
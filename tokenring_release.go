@@ -0,0 +1,8 @@
+//go:build !scssdebug
+// +build !scssdebug
+
+package scss
+
+// debugMarks turns on checks that every Mark on a TokenRing is matched by
+// exactly one Backtrack or Unmark. Build with -tags scssdebug to enable them.
+const debugMarks = false
@@ -0,0 +1,82 @@
+package scss
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss/lexer"
+)
+
+func Test_TokenRingBacktrack(t *testing.T) {
+	src := strings.Repeat("a ", 500)
+	tok := NewTokenRing(lexer.New(src, nullState))
+
+	// Read well past the point where tokens get released, and come back
+	for i := 0; i < 100; i++ {
+		tok.Next()
+	}
+	tok.Mark()
+	start := tok.index
+	var first []*lexer.Token
+	for i := 0; i < 300; i++ {
+		first = append(first, tok.Next())
+	}
+	tok.Backtrack()
+	for i, expected := range first {
+		if got := tok.Next(); got != expected {
+			t.Fatalf("token %d after backtracking is %v, expected %v", start+i, got, expected)
+		}
+	}
+
+	// Reading past the end, and then backtracking
+	tok.Mark()
+	for tok.Next() != nil {
+	}
+	if tok.Peek() != nil || tok.Next() != nil {
+		t.Errorf("expected nothing after the end")
+	}
+	tok.Backtrack()
+	if got := tok.Next(); got == nil || got.Value != "a" {
+		t.Errorf("expected to read tokens again after backtracking from the end, got %v", got)
+	}
+}
+
+func Test_TokenRingReleases(t *testing.T) {
+	src := strings.Repeat(".foo .bar { color: red; .baz { margin: 0 auto; } }\n", 2000)
+	tok := NewTokenRing(lexer.New(src, nullState))
+	ir, err := parseIR(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ir.Rules) != 2000 {
+		t.Fatalf("expected 2000 rules, got %d", len(ir.Rules))
+	}
+
+	// All tokens after the start of the last rule are kept, but no more
+	// than a few hundred in total
+	if tok.index < 50000 || cap(tok.buffer) > 512 {
+		t.Errorf("kept %d of %d tokens", cap(tok.buffer), tok.index)
+	}
+}
+
+func Test_TokenRingUnbalanced(t *testing.T) {
+	defer func() {
+		r := recover()
+		if debugMarks && r == nil {
+			t.Errorf("expected a panic in a debug build")
+		} else if !debugMarks && r != nil {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+
+	tok := NewTokenRing(lexer.New("a b c", nullState))
+	tok.Next()
+	tok.Mark()
+	tok.Next()
+	tok.Backtrack()
+	tok.Backtrack()
+	if tok.index != 1 {
+		t.Errorf("expected a Backtrack without a Mark to stay put")
+	}
+	tok.Balanced()
+}
@@ -0,0 +1,209 @@
+package scss
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Value is the result of evaluating a SassScript expression
+type Value interface {
+	// CSS returns the value as it appears in the output
+	CSS() string
+}
+
+// A String is a quoted or unquoted string. Anything that isn't recognised as
+// another type of value, such as a colour or a call to a plain CSS function,
+// is represented as an unquoted string.
+type String struct {
+	Text   string
+	Quoted bool
+}
+
+// CSS returns the string as it appears in the output. Quotes, backslashes
+// and control characters in a quoted string are escaped.
+func (s String) CSS() string {
+	if !s.Quoted {
+		return s.Text
+	}
+
+	var rv strings.Builder
+	rv.WriteByte('"')
+	for _, r := range s.Text {
+		if r == '"' || r == '\\' {
+			rv.WriteByte('\\')
+			rv.WriteRune(r)
+		} else if r < 0x20 || r == 0x7f {
+			rv.WriteString("\\" + strconv.FormatInt(int64(r), 16) + " ")
+		} else {
+			rv.WriteRune(r)
+		}
+	}
+	rv.WriteByte('"')
+	return rv.String()
+}
+
+// A Number is a number with an optional unit, such as "12px" or "50%"
+type Number struct {
+	Value float64
+	Unit  string
+}
+
+func (n Number) CSS() string {
+	return strconv.FormatFloat(n.Value, 'f', -1, 64) + n.Unit
+}
+
+type Bool bool
+
+func (b Bool) CSS() string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// Null is the absence of a value
+type Null struct{}
+
+func (Null) CSS() string {
+	return ""
+}
+
+// A List is a space- or comma-separated list of values
+type List struct {
+	Items []Value
+	Comma bool
+}
+
+func (l List) CSS() string {
+	sep := " "
+	if l.Comma {
+		sep = ", "
+	}
+	rv := make([]string, 0, len(l.Items))
+	for _, v := range l.Items {
+		if s := v.CSS(); s != "" {
+			rv = append(rv, s)
+		}
+	}
+	return strings.Join(rv, sep)
+}
+
+// IsTruthy reports whether a value counts as true in a condition. Only false
+// and null don't.
+func IsTruthy(v Value) bool {
+	if v == nil {
+		return false
+	} else if b, ok := v.(Bool); ok {
+		return bool(b)
+	} else if _, ok := v.(Null); ok {
+		return false
+	}
+	return true
+}
+
+var numberPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]+)?|\.[0-9]+)([eE][+-]?[0-9]+)?([a-zA-Z]+|%)?$`)
+
+// parseValue interprets an expression in CSS source text as a Value
+func parseValue(text string) Value {
+	text = strings.TrimSpace(text)
+	if text == "" || text == "null" {
+		return Null{}
+	} else if text == "true" {
+		return Bool(true)
+	} else if text == "false" {
+		return Bool(false)
+	}
+
+	if len(text) >= 2 && text[0] == '(' && closingParen(text, 0) == len(text)-1 {
+		items := splitTopLevel(text[1:len(text)-1], ',')
+		if len(items) == 1 {
+			return parseValue(items[0])
+		}
+		rv := List{Comma: true}
+		for _, item := range items {
+			rv.Items = append(rv.Items, parseValue(item))
+		}
+		return rv
+	}
+
+	if words := splitTopLevel(text, ' '); len(words) > 1 {
+		rv := List{}
+		for _, w := range words {
+			if w != "" {
+				rv.Items = append(rv.Items, parseValue(w))
+			}
+		}
+		return rv
+	}
+
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0] {
+		return String{Text: unquote(text), Quoted: true}
+	}
+
+	if m := numberPattern.FindStringSubmatch(text); m != nil {
+		unit := m[4]
+		f, err := strconv.ParseFloat(text[:len(text)-len(unit)], 64)
+		if err == nil {
+			return Number{f, unit}
+		}
+	}
+
+	return String{Text: text}
+}
+
+// splitTopLevel splits text at every occurrence of sep that isn't inside
+// quotes or parentheses
+func splitTopLevel(text string, sep byte) []string {
+	var rv []string
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		} else if c == sep && depth == 0 {
+			rv = append(rv, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(rv, strings.TrimSpace(text[start:]))
+}
+
+// closingParen returns the position of the parenthesis that closes the one at
+// text[open], or -1 if there is none.
+func closingParen(text string, open int) int {
+	var quote byte
+	depth := 0
+	for i := open; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package scss_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thijzert/go-scss"
+	"github.com/thijzert/go-scss/internal/diff"
+)
+
+var update = flag.Bool("update", false, "Rewrite the expected output of the test vectors")
+
+// Test_Vectors compiles every stylesheet in test_vectors/source, and compares
+// the output to the file with the same name in test_vectors/expected. If
+// compiling should fail, that file has the extension .err rather than .css,
+// and lists the errors as "line:column: message", one on each line.
+func Test_Vectors(t *testing.T) {
+	sources, err := filepath.Glob("test_vectors/source/*.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no test vectors found")
+	}
+
+	for _, source := range sources {
+		name := strings.TrimSuffix(filepath.Base(source), ".scss")
+		t.Run(name, func(t *testing.T) {
+			testVector(t, source, filepath.Join("test_vectors", "expected", name))
+		})
+	}
+}
+
+func testVector(t *testing.T, source, expected string) {
+	c := scss.NewCompiler(scss.Options{})
+	res, err := c.CompileFile(source)
+
+	ext, got := ".css", res.CSS
+	if err != nil {
+		ext, got = ".err", vectorErrors(err)
+	}
+
+	if *update {
+		os.Remove(expected + ".css")
+		os.Remove(expected + ".err")
+		if err := ioutil.WriteFile(expected+ext, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, rerr := ioutil.ReadFile(expected + ext)
+	if os.IsNotExist(rerr) {
+		if err != nil {
+			t.Fatalf("unexpected error:\n%s", got)
+		}
+		t.Fatalf("expected an error, but it compiled to:\n%s", got)
+	} else if rerr != nil {
+		t.Fatal(rerr)
+	}
+
+	if d := diff.Unified(expected+ext, "observed", string(want), got); d != "" {
+		t.Errorf("output differs:\n%s", d)
+	}
+}
+
+// vectorErrors formats a compilation error the way .err files list them. The
+// file name is left out, since it's always the source file.
+func vectorErrors(err error) string {
+	rv := ""
+	for _, d := range scss.Diagnose(err, "", "") {
+		rv += fmt.Sprintf("%s: %s\n", d.Span.Start, d.Message)
+	}
+	return rv
+}